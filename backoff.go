@@ -0,0 +1,52 @@
+package inspect
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReconnectBase = 5 * time.Second
+	defaultReconnectMax  = 10 * time.Minute
+)
+
+// Backoff computes exponentially growing delays with jitter for consecutive failures,
+// so bots failing at the same time, e.g. during a Steam outage, don't retry in lockstep
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	attempts atomic.Int32
+}
+
+// Next returns the delay for the next attempt, between half and the full exponential delay
+func (b *Backoff) Next() time.Duration {
+
+	base, max := b.Base, b.Max
+	if base <= 0 {
+		base = defaultReconnectBase
+	}
+	if max <= 0 {
+		max = defaultReconnectMax
+	}
+
+	// Capped before shifting, so it can't overflow
+	n := min(b.attempts.Add(1)-1, 62)
+	d := max
+	if base <= max>>n {
+		d = base << n
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+// Reset starts over after a success
+func (b *Backoff) Reset() {
+	b.attempts.Store(0)
+}
+
+// Attempts returns the consecutive failures since the last reset
+func (b *Backoff) Attempts() int {
+	return int(b.attempts.Load())
+}
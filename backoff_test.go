@@ -0,0 +1,55 @@
+package inspect
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+
+	for _, c := range []struct {
+		name      string
+		base, max time.Duration
+		want      []time.Duration // Full delay of each attempt, the jitter takes up to half of it
+	}{
+		{"exponential", time.Second, time.Minute, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{"capped", 10 * time.Second, 25 * time.Second, []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second, 25 * time.Second}},
+		{"defaults", 0, 0, []time.Duration{defaultReconnectBase, 2 * defaultReconnectBase}},
+		{"large cap", time.Hour, 1 << 62, []time.Duration{time.Hour, 2 * time.Hour}},
+	} {
+		for i, want := range c.want {
+			// Jitter is random, so every attempt is sampled a few times
+			for range 50 {
+				b := &Backoff{Base: c.base, Max: c.max}
+				b.attempts.Store(int32(i))
+				if d := b.Next(); d < want/2 || d > want {
+					t.Fatalf("%s: attempt %d: expected between %s and %s, got %s", c.name, i, want/2, want, d)
+				}
+			}
+		}
+	}
+
+	// Far beyond the cap, the shift must not overflow
+	for _, max := range []time.Duration{time.Minute, 1 << 62} {
+		b := &Backoff{Base: time.Hour, Max: max}
+		b.attempts.Store(40)
+		if d := b.Next(); d < max/2 || d > max {
+			t.Fatalf("expected the cap of %s after many attempts, got %s", max, d)
+		}
+	}
+
+	b := &Backoff{Base: time.Second, Max: time.Minute}
+	b.attempts.Store(100)
+	b.Next()
+
+	if b.Attempts() != 101 {
+		t.Fatalf("expected 101 attempts, got %d", b.Attempts())
+	}
+	b.Reset()
+	if b.Attempts() != 0 {
+		t.Fatal("attempts not reset")
+	}
+	if d := b.Next(); d < 500*time.Millisecond || d > time.Second {
+		t.Fatalf("expected the base delay after a reset, got %s", d)
+	}
+}
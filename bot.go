@@ -1,13 +1,16 @@
 package inspect
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
 	cs2 "github.com/0xAozora/cs2-inspect/cs2/protocol/protobuf"
 
-	"github.com/0xAozora/epoller"
+	"github.com/0xAozora/go-steam/netutil"
 	"github.com/0xAozora/go-steam/protocol/gamecoordinator"
 	"github.com/rs/zerolog"
 	"golang.org/x/net/proxy"
@@ -15,6 +18,8 @@ import (
 	"github.com/0xAozora/go-steam"
 )
 
+var errBotRemoved = errors.New("bot removed")
+
 type BotStatus uint8
 
 const (
@@ -22,29 +27,109 @@ const (
 	CONNECTED
 	LOGGED_IN
 	INGAME
+	GC_WAITING // Logged in, the GC dropped the session or queues the bot, waiting for a welcome
 )
 
+var botStatusNames = [...]string{
+	DISCONNECTED: "DISCONNECTED",
+	CONNECTED:    "CONNECTED",
+	LOGGED_IN:    "LOGGED_IN",
+	INGAME:       "INGAME",
+	GC_WAITING:   "GC_WAITING",
+}
+
+func (s BotStatus) String() string {
+	if int(s) < len(botStatusNames) {
+		return botStatusNames[s]
+	}
+	return "UNKNOWN"
+}
+
+func (s BotStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type Credentials struct {
 	Name         string
 	Password     string
 	SharedSecret string
 }
 
+const redacted = "[REDACTED]"
+
+// String redacts the secrets, so they don't end up in logs
+func (c Credentials) String() string {
+	return fmt.Sprintf("{Name:%s Password:%s SharedSecret:%s}", c.Name, redactSecret(c.Password), redactSecret(c.SharedSecret))
+}
+
+func (c Credentials) GoString() string {
+	return "inspect.Credentials" + c.String()
+}
+
+func (c Credentials) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("name", c.Name).
+		Str("password", redactSecret(c.Password)).
+		Str("shared_secret", redactSecret(c.SharedSecret))
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
 type Bot struct {
 	client      *steam.Client
-	fd          uint64 // File descriptor for this bots connection
+	conn        net.Conn               // Raw connection to the CM or proxy
+	polled      atomic.Pointer[fdConn] // Connection registered in the poller, written under the botMutex of the Handler
+	fd          uint64                 // File descriptor for this bots connection, the ID for pollers keyed on the connection
 	lastInspect time.Time
+	connectedAt time.Time // Zero once ingame
 
 	Credentials
 
-	index int // Index in the Bot Queue
+	index          int    // Index in the Bot Queue
+	slot           int    // Proxy and local address, taken over by the next bot added after removal
+	id             uint64 // Stable ID assigned by the Handler, unlike the name it is unique
+	removed        atomic.Bool
+	disabled       atomic.Bool // Login failed for good, e.g. invalid password
+	disabledReason string
+	backoff        Backoff // Delays reconnects and logins, reset once ingame
+
+	// GC session
+	helloBackoff    Backoff
+	hello           TaskHandle // Scheduled hello, nil if none
+	helloAttempts   int        // Hellos since the last welcome or connection status
+	gcQueuePosition int32
+	gcQueueSize     int32
+
+	// Account used elsewhere
+	conflict      string
+	conflictAt    time.Time  // Last conflict, kept after it got resolved
+	conflictUntil time.Time  // End of yielding to the other session
+	reclaim       TaskHandle // Scheduled end of the yield, nil if none
+
+	renewal     TaskHandle   // Scheduled renewal of the refresh token
+	tokenExpiry atomic.Int64 // Unix time, 0 if unknown
+
+	gcMutex sync.Mutex // Mutex for the GC session, conflict and renewal fields, except the backoff and expiry
+
+	transport Transport
+	cms       *CMSelector
+	region    atomic.Pointer[string] // Proxy session or local address the bot connects from
+	cm        atomic.Pointer[string] // Current CM, both are read by GetBotInfos while connecting
 
 	status BotStatus
-	//steamStatus *uint8 // TODO: Implement Global Steam status and point to it to correctly handle instances like offline Steam Servers
 
 	log *zerolog.Logger
 }
 
+// String returns the name, the Credentials would be promoted otherwise
+func (bot *Bot) String() string {
+	return bot.Name
+}
+
 func NewBot(Credentials Credentials, logger *zerolog.Logger) *Bot {
 	client := steam.NewManualClient()
 	client.Auth = &steam.Auth{Client: client}
@@ -57,27 +142,39 @@ func NewBot(Credentials Credentials, logger *zerolog.Logger) *Bot {
 	}
 }
 
-func (bot *Bot) Connect(dialer proxy.Dialer) net.Conn {
+// Connect connects to a CM once, the Handler schedules the retries
+// It returns the raw connection to register in the poller
+func (bot *Bot) Connect(dialer proxy.Dialer) (net.Conn, error) {
 
-	bot.client.Proxy = dialer
-	for {
-		cm := steam.GetRandomCM()
+	if bot.removed.Load() {
+		return nil, errBotRemoved
+	}
 
-		bot.log.Info().
-			Str("bot", bot.Name).
-			Str("cm", cm.String()).
-			Msg("Connecting to CM")
+	region := bot.getRegion()
 
-		err := bot.client.ConnectTo(cm)
-		if err == nil {
-			break
-		}
+	var cm string
+	if bot.cms != nil {
+		cm = bot.cms.Select(region)
+	} else if bot.transport == TCP {
+		cm = steam.GetRandomCM().String()
+	}
+	bot.cm.Store(&cm)
 
-		bot.log.Err(err).
-			Str("bot", bot.Name).
-			Msg("Failed to connect to CM")
+	bot.log.Info().
+		Str("bot", bot.Name).
+		Str("cm", cm).
+		Msg("Connecting to CM")
 
-		time.Sleep(5 * time.Second)
+	start := time.Now()
+	conn, err := bot.connectTo(dialer, cm)
+	if err != nil {
+		if bot.cms != nil && cm != "" {
+			bot.cms.Failure(region, cm)
+		}
+		return nil, fmt.Errorf("connecting to CM %q: %w", cm, err)
+	}
+	if bot.cms != nil {
+		bot.cms.Success(region, cm, time.Since(start))
 	}
 
 	bot.log.Info().
@@ -85,11 +182,70 @@ func (bot *Bot) Connect(dialer proxy.Dialer) net.Conn {
 		Msg("Connection established")
 
 	bot.status = CONNECTED
+	bot.connectedAt = time.Now()
+
+	bot.conn = conn
+
+	return conn, nil
+}
+
+// connectTo connects the client and returns the raw connection
+func (bot *Bot) connectTo(dialer proxy.Dialer, address string) (net.Conn, error) {
+
+	if address == "" {
+		return nil, errors.New("no CM available")
+	}
+
+	hook := &hookDialer{dialer: dialer}
+
+	if bot.transport == WebSocket {
+		ws, err := dialWebSocket(hook, address)
+		if err != nil {
+			// Dialing succeeded, so the CM closed it during the handshake
+			if hook.conn != nil && closedByCM(err) {
+				err = fmt.Errorf("%w: %w", errCMClosed, err)
+			}
+			return nil, err
+		}
 
-	conn := getTCPConn(bot.client)
-	bot.fd = epoller.GetFD(unsafe.Pointer(conn))
+		// ConnectTo is the only way to set up the client, so we let it "dial" our connection and replace it afterwards
+		bot.client.Proxy = connDialer{conn: hook.conn}
+		if err = bot.client.ConnectTo(&netutil.PortAddr{}); err != nil {
+			ws.Close()
+			return nil, err
+		}
+		bot.client.Conn = ws
+
+		return hook.conn, nil
+	}
 
-	return conn
+	cm := netutil.ParsePortAddr(address)
+	if cm == nil {
+		return nil, fmt.Errorf("invalid CM address %q", address)
+	}
+
+	bot.client.Proxy = hook
+	if err := bot.client.ConnectTo(cm); err != nil {
+		return nil, err
+	}
+
+	// Replace the connection of go-steam with our buffered one
+	bot.client.Conn = newTCPConnection(hook.conn)
+
+	return hook.conn, nil
+}
+
+// pollConn returns the connection to register in the poller under the key fd
+func (bot *Bot) pollConn(fd uint64) *fdConn {
+	c := &fdConn{Conn: bot.conn, fd: fd}
+	c.reader, _ = bot.client.Conn.(readWaiter)
+	return c
+}
+
+// pending reports whether the connection holds buffered data the poller doesn't know about
+func (bot *Bot) pending() bool {
+	c, ok := bot.client.Conn.(interface{ Pending() bool })
+	return ok && c.Pending()
 }
 
 func (bot *Bot) Login(refreshToken string, auth steam.Authenticator) {
@@ -133,3 +289,90 @@ func (bot *Bot) Inspect(s, a, d, m uint64) error {
 
 	return nil
 }
+
+func (bot *Bot) cancelHello() {
+	bot.gcMutex.Lock()
+	if bot.hello != nil {
+		bot.hello.Cancel()
+		bot.hello = nil
+	}
+	bot.helloAttempts = 0
+	bot.gcMutex.Unlock()
+}
+
+func (bot *Bot) cancelReclaim() {
+	bot.gcMutex.Lock()
+	if bot.reclaim != nil {
+		bot.reclaim.Cancel()
+		bot.reclaim = nil
+	}
+	bot.gcMutex.Unlock()
+}
+
+func (bot *Bot) cancelRenewal() {
+	bot.gcMutex.Lock()
+	if bot.renewal != nil {
+		bot.renewal.Cancel()
+		bot.renewal = nil
+	}
+	bot.gcMutex.Unlock()
+}
+
+func (bot *Bot) setGCQueue(position, size int32) {
+	bot.gcMutex.Lock()
+	bot.gcQueuePosition, bot.gcQueueSize = position, size
+	bot.gcMutex.Unlock()
+}
+
+func (bot *Bot) gcQueue() (position, size int32) {
+	bot.gcMutex.Lock()
+	defer bot.gcMutex.Unlock()
+	return bot.gcQueuePosition, bot.gcQueueSize
+}
+
+func (bot *Bot) setConflict(conflict string, at, until time.Time) {
+	bot.gcMutex.Lock()
+	bot.conflict, bot.conflictAt, bot.conflictUntil = conflict, at, until
+	bot.gcMutex.Unlock()
+}
+
+func (bot *Bot) getRegion() string {
+	if region := bot.region.Load(); region != nil {
+		return *region
+	}
+	return ""
+}
+
+func (bot *Bot) getCM() string {
+	if cm := bot.cm.Load(); cm != nil {
+		return *cm
+	}
+	return ""
+}
+
+func (bot *Bot) getConflict() (conflict string, at, until time.Time) {
+	bot.gcMutex.Lock()
+	defer bot.gcMutex.Unlock()
+	return bot.conflict, bot.conflictAt, bot.conflictUntil
+}
+
+// yielding reports whether the bot leaves the session to the other client right now
+func (bot *Bot) yielding() bool {
+	bot.gcMutex.Lock()
+	defer bot.gcMutex.Unlock()
+	return time.Now().Before(bot.conflictUntil)
+}
+
+// endYield keeps the conflict until the welcome, but stops yielding
+func (bot *Bot) endYield() {
+	bot.gcMutex.Lock()
+	bot.conflictUntil = time.Time{}
+	bot.gcMutex.Unlock()
+}
+
+// clearConflict resolves the conflict once the bot got its session back
+func (bot *Bot) clearConflict() {
+	bot.gcMutex.Lock()
+	bot.conflict, bot.conflictUntil = "", time.Time{}
+	bot.gcMutex.Unlock()
+}
@@ -0,0 +1,83 @@
+package inspect
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// botTable maps the file descriptors of registered connections to their bots.
+// File descriptors are small and reused by the kernel, so a slice indexed by them stays dense.
+// Pollers keyed on the connection don't need file descriptors, the bot IDs are used instead.
+// Reads are lock-free, writes have to be serialized by the caller (botMutex)
+// and copy the slice only when it needs to grow.
+type botTable struct {
+	slots atomic.Pointer[[]atomic.Pointer[Bot]]
+}
+
+func newBotTable(size int) *botTable {
+	slots := make([]atomic.Pointer[Bot], max(size, 64))
+	t := &botTable{}
+	t.slots.Store(&slots)
+	return t
+}
+
+// Load returns the bot registered for fd, nil if there is none
+func (t *botTable) Load(fd uint64) *Bot {
+	slots := *t.slots.Load()
+	if fd >= uint64(len(slots)) {
+		return nil
+	}
+	return slots[fd].Load()
+}
+
+// Store registers the bot for fd
+func (t *botTable) Store(fd uint64, bot *Bot) {
+	slots := *t.slots.Load()
+	if fd >= uint64(len(slots)) {
+		grown := make([]atomic.Pointer[Bot], max(2*len(slots), int(fd)+1))
+		for i := range slots {
+			grown[i].Store(slots[i].Load())
+		}
+		t.slots.Store(&grown)
+		slots = grown
+	}
+	slots[fd].Store(bot)
+}
+
+// Delete removes the bot registered for fd, if it is still the given one
+func (t *botTable) Delete(fd uint64, bot *Bot) bool {
+	slots := *t.slots.Load()
+	if fd >= uint64(len(slots)) {
+		return false
+	}
+	return slots[fd].CompareAndSwap(bot, nil)
+}
+
+// Range calls f for every registered bot until it returns false
+func (t *botTable) Range(f func(fd uint64, bot *Bot) bool) {
+	slots := *t.slots.Load()
+	for i := range slots {
+		if bot := slots[i].Load(); bot != nil && !f(uint64(i), bot) {
+			return
+		}
+	}
+}
+
+// fdConn is the connection registered in the poller,
+// it carries the file descriptor so readiness events map to the bot table without a lookup by interface value
+type fdConn struct {
+	net.Conn
+	fd     uint64
+	reader readWaiter // Buffered connection of the bot, for pollers waiting on connections without file descriptor
+}
+
+func (c *fdConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *fdConn) WaitReadable() error {
+	if c.reader == nil {
+		return ErrNotPollable
+	}
+	return c.reader.WaitReadable()
+}
@@ -0,0 +1,136 @@
+package inspect
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+)
+
+func TestBotTable(t *testing.T) {
+
+	table := newBotTable(0)
+	a, b := &Bot{}, &Bot{}
+
+	table.Store(3, a)
+	table.Store(1000, b) // Grows the table
+	if table.Load(3) != a || table.Load(1000) != b {
+		t.Fatal("lost bot after growing")
+	}
+	if table.Load(4) != nil || table.Load(1<<40) != nil {
+		t.Fatal("unexpected bot")
+	}
+
+	// Only the registered bot may remove itself, the fd might belong to another one by now
+	if table.Delete(3, b) {
+		t.Fatal("deleted another bot")
+	}
+	if !table.Delete(3, a) || table.Load(3) != nil {
+		t.Fatal("bot not deleted")
+	}
+
+	var n int
+	table.Range(func(fd uint64, bot *Bot) bool {
+		if fd != 1000 || bot != b {
+			t.Fatalf("unexpected bot at %d", fd)
+		}
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("expected 1 bot, got %d", n)
+	}
+}
+
+// BenchmarkDispatch measures how handleClients maps a batch of ready connections to their bots,
+// while other bots get registered and removed concurrently
+func BenchmarkDispatch(b *testing.B) {
+	for _, bots := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("bots=%d/map", bots), func(b *testing.B) {
+			benchmarkDispatch(b, bots, false)
+		})
+		b.Run(fmt.Sprintf("bots=%d/table", bots), func(b *testing.B) {
+			benchmarkDispatch(b, bots, true)
+		})
+	}
+}
+
+func benchmarkDispatch(b *testing.B, bots int, table bool) {
+
+	const batch = 100
+
+	// Connection keyed map as before
+	var mutex sync.RWMutex
+	m := make(map[net.Conn]*Bot, bots)
+	t := newBotTable(bots)
+
+	ready := make([]net.Conn, bots)
+	for i := range bots {
+		conn := &readerConn{}
+		bot := &Bot{conn: conn, fd: uint64(i)}
+		m[conn] = bot
+		t.Store(bot.fd, bot)
+		if table {
+			fc := &fdConn{Conn: conn, fd: bot.fd}
+			bot.polled.Store(fc)
+			ready[i] = fc
+		} else {
+			ready[i] = conn
+		}
+	}
+
+	// Reconnecting bots
+	var stop atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; !stop.Load(); i++ {
+			conn := &readerConn{}
+			bot := &Bot{conn: conn, fd: uint64(bots + i%batch)}
+			mutex.Lock()
+			m[conn] = bot
+			t.Store(bot.fd, bot)
+			mutex.Unlock()
+
+			mutex.Lock()
+			delete(m, conn)
+			t.Delete(bot.fd, bot)
+			mutex.Unlock()
+		}
+	}()
+
+	var found int
+	b.ResetTimer()
+	for i := range b.N {
+		offset := i * batch % (bots - batch)
+		for _, c := range ready[offset : offset+batch] {
+
+			var bot *Bot
+			if table {
+				fc := c.(*fdConn)
+				if bot = t.Load(fc.fd); bot == nil || bot.polled.Load() != fc {
+					continue
+				}
+			} else {
+				mutex.RLock()
+				bot = m[c]
+				mutex.RUnlock()
+				if bot == nil {
+					continue
+				}
+			}
+			found++
+		}
+	}
+	b.StopTimer()
+
+	stop.Store(true)
+	<-done
+
+	if found != b.N*batch {
+		b.Fatalf("expected %d bots, found %d", b.N*batch, found)
+	}
+}
@@ -0,0 +1,211 @@
+package inspect
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	cmSelectTop         = 3                // Pick randomly among the fastest healthy CMs
+	cmExploreRate       = 0.1              // Chance to try an unmeasured CM instead
+	cmBlacklistBase     = 30 * time.Second // Blacklist duration after the first failure, doubled for each consecutive one
+	cmBlacklistMax      = 30 * time.Minute
+	cmLatencySmoothing  = 0.3 // Weight of a new latency sample
+	cmGoodListMaxLength = 32
+)
+
+type cmStats struct {
+	latency     time.Duration // Smoothed connect latency, 0 if never connected
+	failures    int           // Consecutive failures
+	blacklisted int64         // Blacklisted until, unix nano
+}
+
+// CMSelector picks the CM a bot connects to.
+// It tracks connect latency and failures per CM and region (proxy session or local address),
+// temporarily blacklists failing CMs and prefers the fastest healthy ones.
+// The last known good CMs are persisted along with the Steam directory, to be preferred at startup.
+type CMSelector struct {
+	servers   []string
+	preferred map[string]struct{}            // Known good CMs of a previous run, tried before other unmeasured ones
+	regions   map[string]map[string]*cmStats // Map Region to CM to Stats
+	mutex     sync.Mutex
+
+	rng *rand.Rand
+}
+
+// NewCMSelector creates a CMSelector with an initial CM list, e.g. steam.CMServers
+func NewCMSelector(servers []string) *CMSelector {
+	return &CMSelector{
+		servers: servers,
+		regions: make(map[string]map[string]*cmStats),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetServers replaces the CM list, stats of known CMs are kept
+func (s *CMSelector) SetServers(servers []string) {
+	if len(servers) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	s.servers = servers
+	s.mutex.Unlock()
+}
+
+// Servers returns the amount of CMs to select from
+func (s *CMSelector) Servers() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.servers)
+}
+
+// Select returns the CM a bot in the given region should connect to
+func (s *CMSelector) Select(region string) string {
+
+	now := time.Now().UnixNano()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.regions[region]
+
+	var measured, unmeasured []string
+	var fallback string
+	var fallbackUntil int64
+	for _, cm := range s.servers {
+		st := stats[cm]
+		if st == nil {
+			unmeasured = append(unmeasured, cm)
+			continue
+		}
+		if st.blacklisted > now {
+			// Remember the CM which gets out of the blacklist first, in case all are blacklisted
+			if fallback == "" || st.blacklisted < fallbackUntil {
+				fallback, fallbackUntil = cm, st.blacklisted
+			}
+			continue
+		}
+		if st.latency == 0 {
+			unmeasured = append(unmeasured, cm)
+			continue
+		}
+		measured = append(measured, cm)
+	}
+
+	if len(unmeasured) != 0 && (len(measured) < cmSelectTop || s.rng.Float64() < cmExploreRate) {
+		// Known good ones first
+		if preferred := slices.DeleteFunc(slices.Clone(unmeasured), func(cm string) bool {
+			_, ok := s.preferred[cm]
+			return !ok
+		}); len(preferred) != 0 {
+			unmeasured = preferred
+		}
+		return unmeasured[s.rng.Intn(len(unmeasured))]
+	}
+
+	if len(measured) == 0 {
+		return fallback
+	}
+
+	slices.SortFunc(measured, func(a, b string) int {
+		return cmp.Compare(stats[a].latency, stats[b].latency)
+	})
+
+	return measured[s.rng.Intn(min(cmSelectTop, len(measured)))]
+}
+
+// Success records a successful connection to the CM
+func (s *CMSelector) Success(region, cm string, latency time.Duration) {
+
+	s.mutex.Lock()
+	st := s.stats(region, cm)
+	if st.latency == 0 {
+		st.latency = latency
+	} else {
+		st.latency += time.Duration(cmLatencySmoothing * float64(latency-st.latency))
+	}
+	st.failures = 0
+	st.blacklisted = 0
+	s.mutex.Unlock()
+}
+
+// Failure records a failed connection or a CM telling us to try another one.
+// The CM gets blacklisted for this region, longer with each consecutive failure.
+func (s *CMSelector) Failure(region, cm string) {
+
+	s.mutex.Lock()
+	st := s.stats(region, cm)
+	st.failures++
+
+	d := cmBlacklistBase << min(st.failures-1, 16)
+	if d > cmBlacklistMax {
+		d = cmBlacklistMax
+	}
+	st.blacklisted = time.Now().Add(d).UnixNano()
+	s.mutex.Unlock()
+}
+
+func (s *CMSelector) stats(region, cm string) *cmStats {
+	stats := s.regions[region]
+	if stats == nil {
+		stats = make(map[string]*cmStats)
+		s.regions[region] = stats
+	}
+	st := stats[cm]
+	if st == nil {
+		st = &cmStats{}
+		stats[cm] = st
+	}
+	return st
+}
+
+// Prefer marks CMs as known good, e.g. from a previous run, they are tried before other unmeasured CMs
+func (s *CMSelector) Prefer(cms []string) {
+
+	preferred := make(map[string]struct{}, len(cms))
+	for _, cm := range cms {
+		preferred[cm] = struct{}{}
+	}
+
+	s.mutex.Lock()
+	s.preferred = preferred
+	s.mutex.Unlock()
+}
+
+// GoodList returns the healthy CMs we could connect to, fastest first
+func (s *CMSelector) GoodList() []string {
+
+	now := time.Now().UnixNano()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	best := make(map[string]time.Duration)
+	for _, stats := range s.regions {
+		for cm, st := range stats {
+			if st.latency == 0 || st.blacklisted > now {
+				continue
+			}
+			if l, ok := best[cm]; !ok || st.latency < l {
+				best[cm] = st.latency
+			}
+		}
+	}
+
+	list := make([]string, 0, len(best))
+	for cm := range best {
+		list = append(list, cm)
+	}
+	slices.SortFunc(list, func(a, b string) int {
+		return cmp.Compare(best[a], best[b])
+	})
+
+	if len(list) > cmGoodListMaxLength {
+		list = list[:cmGoodListMaxLength]
+	}
+	return list
+}
@@ -0,0 +1,106 @@
+package inspect
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCMSelectorSelect(t *testing.T) {
+
+	s := NewCMSelector([]string{"a", "b", "c", "d", "e"})
+
+	// Explores until enough CMs are measured
+	seen := make(map[string]bool)
+	for range 100 {
+		seen[s.Select("region")] = true
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected all CMs explored, got %v", seen)
+	}
+
+	s.Success("region", "a", 50*time.Millisecond)
+	s.Success("region", "b", 10*time.Millisecond)
+	s.Success("region", "c", 20*time.Millisecond)
+	s.Success("region", "d", 30*time.Millisecond)
+	s.Success("region", "e", 40*time.Millisecond)
+
+	// Only the fastest ones once all are measured
+	for range 100 {
+		if cm := s.Select("region"); cm != "b" && cm != "c" && cm != "d" {
+			t.Fatalf("slow CM %s selected", cm)
+		}
+	}
+
+	// Other regions measure on their own
+	seen = make(map[string]bool)
+	for range 100 {
+		seen[s.Select("other")] = true
+	}
+	if len(seen) != 5 {
+		t.Fatalf("measurements leaked into another region, got %v", seen)
+	}
+}
+
+func TestCMSelectorFailure(t *testing.T) {
+
+	s := NewCMSelector([]string{"a", "b", "c", "d"})
+	for i, cm := range []string{"a", "b", "c", "d"} {
+		s.Success("region", cm, time.Duration(i+1)*time.Millisecond)
+	}
+
+	// Failing CMs are blacklisted in their region only
+	s.Failure("region", "a")
+	for range 100 {
+		if s.Select("region") == "a" {
+			t.Fatal("blacklisted CM selected")
+		}
+	}
+	if st := s.regions["region"]["a"]; time.Until(time.Unix(0, st.blacklisted)) > cmBlacklistBase {
+		t.Fatal("blacklisted too long")
+	}
+
+	// Doubled with each consecutive failure
+	s.Failure("region", "a")
+	if st := s.regions["region"]["a"]; time.Until(time.Unix(0, st.blacklisted)) < cmBlacklistBase*2-time.Second {
+		t.Fatal("blacklist not doubled")
+	}
+
+	// If all are blacklisted, the one getting out first
+	s.Failure("region", "b")
+	s.Failure("region", "c")
+	s.Failure("region", "d")
+	if cm := s.Select("region"); cm == "a" || cm == "" {
+		t.Fatalf("expected a CM blacklisted once, got %s", cm)
+	}
+
+	// A success clears it
+	s.Success("region", "a", time.Millisecond)
+	if cm := s.Select("region"); cm != "a" {
+		t.Fatalf("expected a, got %s", cm)
+	}
+}
+
+func TestCMSelectorGoodList(t *testing.T) {
+
+	s := NewCMSelector([]string{"a", "b", "c", "d"})
+	s.Success("one", "a", 30*time.Millisecond)
+	s.Success("two", "a", 5*time.Millisecond)
+	s.Success("one", "b", 10*time.Millisecond)
+	s.Success("one", "c", 20*time.Millisecond)
+	s.Failure("one", "c")
+
+	// Fastest first over all regions, without blacklisted and unmeasured ones
+	if good := s.GoodList(); !slices.Equal(good, []string{"a", "b"}) {
+		t.Fatalf("unexpected good list %v", good)
+	}
+
+	// Persisted good CMs are tried first by a new selector
+	next := NewCMSelector([]string{"a", "b", "c", "d"})
+	next.Prefer(s.GoodList())
+	for range 100 {
+		if cm := next.Select("one"); cm != "a" && cm != "b" {
+			t.Fatalf("expected a known good CM, got %s", cm)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package inspect
+
+import (
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"github.com/rs/zerolog"
+)
+
+// Config holds the settings of a Handler.
+// Optional fields are replaced by the same defaults NewHandler uses.
+type Config struct {
+	Len      int // Initial length of the bot queue
+	Cap      int // Capacity of inspects in flight
+	PoolSize int // Size of the goroutine pool
+
+	// Dialing
+	// A bot without proxy or local address will only connect directly if IgnoreProxy is set
+	ProxyList     *ProxyList
+	LocalAddrList *LocalAddrList
+	IgnoreProxy   bool
+
+	// Protocol to connect to CMs with, TCP by default
+	Transport Transport
+
+	// Cache for the Steam directory and the last known good CMs, loaded at startup before refreshing it,
+	// so we can connect even if the Steam directory is unreachable at startup. FileDirectoryStore keeps it in a file.
+	DirectoryStore DirectoryStore
+
+	// Fetches the CM list of the Steam directory, the Steam Web API by default
+	FetchDirectory func() (*CMList, error)
+
+	// Readiness notification for bot connections, epoll by default
+	// Use NewGoroutinePoller where epoll is not available. It keys connections on the net.Conn,
+	// so it also serves dialers returning connections without file descriptor, which epoll can't.
+	Poller ConnPoller
+
+	// Creates the poller if Poller is nil, and its replacement if it fails for good
+	// Epoll falling back to the goroutine poller by default, or goroutine pollers if Poller is one
+	NewPoller func() (ConnPoller, error)
+
+	// Runs heartbeats, inspect timeouts and reconnects, a TimeTree by default
+	// NewTimingWheel scales better with many tasks in flight
+	Scheduler Scheduler
+
+	// Exponential backoff of reconnects and logins, 5s up to 10min by default
+	ReconnectBase time.Duration
+	ReconnectMax  time.Duration
+
+	// Actions for EResults of failed logins, overriding the ones of DefaultLoginPolicies
+	LoginPolicies map[steamlang.EResult]LoginPolicy
+
+	// Spacing of logins, globally (50ms by default) and per proxy session or local address (2s by default)
+	// Too many logins from one IP get answered with RateLimitExceeded, which pauses logins from it
+	LoginInterval       time.Duration
+	RegionLoginInterval time.Duration
+
+	// Hellos to the GC without welcome before reconnecting, 5 by default
+	// They are spaced by the backoff of the bot, starting at 5s
+	HelloRetries int
+
+	// Client version sent in the hello, DefaultGCVersion by default
+	// It follows the version the GC reports, so a CS2 update doesn't need a new build
+	GCVersion uint32
+
+	// Steam counts as down once OutageThreshold of the bots (0.5 by default), at least OutageMinBots (3 by default),
+	// failed within OutageWindow (1min by default). Inspect queues nothing and SteamDown reports it until a probe bot gets ingame again.
+	// Only failures on the side of Steam count, not the ones of proxies, rate limits or accounts.
+	OutageWindow    time.Duration
+	OutageThreshold float64
+	OutageMinBots   int
+
+	// What to do when the account of a bot is used elsewhere, SessionYield by default
+	// Yielding leaves the session to the other client for SessionYield (30min by default) or until it stops playing
+	SessionPolicy SessionPolicy
+	SessionYield  time.Duration
+
+	// Refresh tokens get renewed this long before they expire, 30 days by default
+	TokenRenewBefore time.Duration
+
+	// What to do with packets while the pool is saturated, OverloadBlock by default
+	// Dropping packets may lose responses the bot waits for, like the logon response, it recovers through reconnects
+	// OverloadCallerRuns handles packets on the poller goroutine, no bot is read meanwhile
+	Overload        OverloadPolicy
+	OverloadTimeout time.Duration // For OverloadDrop, 100ms by default
+
+	Auth          AuthenticationHandler
+	TokenDB       TokenDB
+	Logger        *zerolog.Logger
+	MetricsLogger MetricsLogger
+	EventHandler  EventHandler
+}
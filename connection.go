@@ -0,0 +1,216 @@
+package inspect
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/0xAozora/go-steam/cryptoutil"
+	"github.com/0xAozora/go-steam/protocol"
+)
+
+const (
+	tcpConnectionMagic uint32 = 0x31305456 // "VT01"
+
+	// Most packets, like inspect responses, fit into the read buffer and are decrypted straight out of it
+	tcpReadBufferSize    = 4096
+	tcpScratchBufferSize = 64 << 10 // Larger scratch buffers for big packets are not kept
+	tcpMaxPacketSize     = 64 << 20
+)
+
+// tcpConnection implements the connection of a steam.Client over TCP.
+// Unlike the one of go-steam, it reads through a buffer, so bursts of packets are read with a single syscall
+// and the Handler can drain every complete packet it already got without waiting for the poller again.
+type tcpConnection struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	scratch  []byte // Reused for packets larger than the read buffer
+	writeBuf []byte // Reused for writes, the steam.Client serializes them
+
+	ciph        cipher.Block
+	cipherMutex sync.RWMutex
+}
+
+func newTCPConnection(conn net.Conn) *tcpConnection {
+	return &tcpConnection{
+		conn: conn,
+		r:    bufio.NewReaderSize(conn, tcpReadBufferSize),
+	}
+}
+
+// Read returns the next packet, blocking until it is complete
+func (c *tcpConnection) Read() (*protocol.Packet, error) {
+
+	// All packets begin with a packet length and a magic value
+	header, err := c.r.Peek(8)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check magic value first to validate the connection
+	if magic := binary.LittleEndian.Uint32(header[4:]); magic != tcpConnectionMagic {
+		return nil, fmt.Errorf("invalid connection magic, expected %d, got %d", tcpConnectionMagic, magic)
+	}
+
+	size := int(binary.LittleEndian.Uint32(header))
+	if size > tcpMaxPacketSize {
+		return nil, fmt.Errorf("packet too large: %d", size)
+	}
+
+	var data []byte
+	if size+8 <= c.r.Size() {
+		if data, err = c.r.Peek(size + 8); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		data = data[8:]
+	} else {
+		if cap(c.scratch) < size {
+			c.scratch = make([]byte, size)
+		}
+		data = c.scratch[:size]
+
+		_, _ = c.r.Discard(8)
+		if _, err = io.ReadFull(c.r, data); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+
+	// The packet outlives the buffer, so it needs its own copy
+	var buf []byte
+	c.cipherMutex.RLock()
+	if c.ciph != nil {
+		buf, err = decrypt(c.ciph, data)
+	} else {
+		buf = make([]byte, size)
+		copy(buf, data)
+	}
+	c.cipherMutex.RUnlock()
+
+	if size+8 <= c.r.Size() {
+		_, _ = c.r.Discard(size + 8)
+	} else if cap(c.scratch) > tcpScratchBufferSize {
+		c.scratch = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return protocol.NewPacket(buf)
+}
+
+// WaitReadable blocks until data is available, without consuming it.
+// It must not be called while the connection is being read.
+func (c *tcpConnection) WaitReadable() error {
+	_, err := c.r.Peek(1)
+	return err
+}
+
+// Pending reports whether a complete packet is buffered,
+// the poller won't report the connection as readable for it.
+// It must only be called from the reading goroutine.
+func (c *tcpConnection) Pending() bool {
+
+	n := c.r.Buffered()
+	if n < 8 {
+		return false
+	}
+
+	header, _ := c.r.Peek(8)
+	return n >= int(binary.LittleEndian.Uint32(header))+8
+}
+
+// Write sends a message, encrypting it once the channel is encrypted.
+// This may only be used by one goroutine at a time.
+func (c *tcpConnection) Write(message []byte) error {
+
+	size := len(message)
+
+	c.cipherMutex.RLock()
+	if c.ciph != nil {
+		// Message is padded to the next AES block size + AES block size for the IV
+		size += aes.BlockSize + aes.BlockSize - size%aes.BlockSize
+		c.writeBuf = grow(c.writeBuf, size+8)
+		_ = cryptoutil.SymmetricEncrypt(c.ciph, c.writeBuf[8:], message)
+	} else {
+		c.writeBuf = grow(c.writeBuf, size+8)
+		copy(c.writeBuf[8:], message)
+	}
+	c.cipherMutex.RUnlock()
+
+	binary.LittleEndian.PutUint32(c.writeBuf, uint32(size))
+	binary.LittleEndian.PutUint32(c.writeBuf[4:], tcpConnectionMagic)
+
+	_, err := c.conn.Write(c.writeBuf)
+	return err
+}
+
+func (c *tcpConnection) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tcpConnection) SetEncryptionKey(key []byte) {
+	c.cipherMutex.Lock()
+	defer c.cipherMutex.Unlock()
+
+	if key == nil {
+		c.ciph = nil
+		return
+	}
+
+	// Same as go-steam, a wrong key is a bug
+	ciph, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	c.ciph = ciph
+}
+
+func (c *tcpConnection) IsEncrypted() bool {
+	c.cipherMutex.RLock()
+	defer c.cipherMutex.RUnlock()
+	return c.ciph != nil
+}
+
+// decrypt is cryptoutil.SymmetricDecrypt into a new slice, so src can be reused.
+// The IV is prepended using AES/ECB/None, followed by the data in AES/CBC/PKCS7.
+func decrypt(ciph cipher.Block, src []byte) ([]byte, error) {
+
+	if len(src) < 2*aes.BlockSize || len(src)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted packet size")
+	}
+
+	var iv [aes.BlockSize]byte
+	ciph.Decrypt(iv[:], src[:aes.BlockSize])
+
+	dst := make([]byte, len(src)-aes.BlockSize)
+	cipher.NewCBCDecrypter(ciph, iv[:]).CryptBlocks(dst, src[aes.BlockSize:])
+
+	padding := int(dst[len(dst)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("invalid pkcs7 padding")
+	}
+
+	return dst[:len(dst)-padding], nil
+}
+
+func grow(b []byte, size int) []byte {
+	if cap(b) >= size {
+		return b[:size]
+	}
+	return make([]byte, size)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return io.EOF
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+
+	"github.com/0xAozora/go-steam/cryptoutil"
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+func TestTCPConnectionRead(t *testing.T) {
+
+	ciph, burst := testBurst(t, 5)
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	// Packets arrive in uneven chunks, split inside header and body
+	go func() {
+		for i := 0; i < len(burst); i += 7 {
+			_, _ = server.Write(burst[i:min(i+7, len(burst))])
+		}
+		server.Close()
+	}()
+
+	conn := newTCPConnection(client)
+	conn.ciph = ciph
+
+	for range 5 {
+		packet, err := conn.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.EMsg != steamlang.EMsg_ClientHeartBeat {
+			t.Fatalf("expected %v, got %v", steamlang.EMsg_ClientHeartBeat, packet.EMsg)
+		}
+	}
+
+	if _, err := conn.Read(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestTCPConnectionPending(t *testing.T) {
+
+	ciph, burst := testBurst(t, 3)
+
+	conn := newTCPConnection(&readerConn{Reader: bytes.NewReader(burst)})
+	conn.ciph = ciph
+
+	// The first read buffers the whole burst
+	for i := range 3 {
+		if _, err := conn.Read(); err != nil {
+			t.Fatal(err)
+		}
+		if pending := conn.Pending(); pending != (i < 2) {
+			t.Fatalf("packet %d: expected pending %t", i, i < 2)
+		}
+	}
+}
+
+// BenchmarkReadBurst simulates every bot receiving a burst of packets.
+// Before, each readiness event read a single packet with two unbuffered reads,
+// so a burst took as many wakeups of the poller as it had packets.
+func BenchmarkReadBurst(b *testing.B) {
+	for _, bots := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("bots=%d/single", bots), func(b *testing.B) {
+			benchmarkReadBurst(b, bots, false)
+		})
+		b.Run(fmt.Sprintf("bots=%d/drain", bots), func(b *testing.B) {
+			benchmarkReadBurst(b, bots, true)
+		})
+	}
+}
+
+func benchmarkReadBurst(b *testing.B, bots int, drain bool) {
+
+	const packets = 8
+	ciph, burst := testBurst(b, packets)
+
+	poller, err := NewEpollPoller(bots)
+	if err != nil {
+		b.Skip(err)
+	}
+	defer poller.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+
+	conns := make(map[net.Conn]*tcpConnection, bots)
+	servers := make([]net.Conn, 0, bots)
+	for range bots {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			b.Skip(err) // Most likely the file descriptor limit
+		}
+		server, err := ln.Accept()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer client.Close()
+		defer server.Close()
+
+		fd, err := pollFD(client)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = poller.Add(client, fd); err != nil {
+			b.Fatal(err)
+		}
+
+		conn := newTCPConnection(client)
+		conn.ciph = ciph
+		conns[client] = conn
+		servers = append(servers, server)
+	}
+
+	var wakeups int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+
+		b.StopTimer()
+		for _, server := range servers {
+			if _, err = server.Write(burst); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+
+		for remaining := bots * packets; remaining > 0; {
+			ready, err := poller.Wait(bots)
+			if err != nil {
+				b.Fatal(err)
+			}
+			wakeups++
+
+			for _, c := range ready {
+				if !drain {
+					if _, err = readUnbuffered(c, ciph); err != nil {
+						b.Fatal(err)
+					}
+					remaining--
+					continue
+				}
+
+				conn := conns[c]
+				for {
+					if _, err = conn.Read(); err != nil {
+						b.Fatal(err)
+					}
+					remaining--
+					if !conn.Pending() {
+						break
+					}
+				}
+			}
+		}
+	}
+
+	b.ReportMetric(float64(wakeups)/float64(b.N), "wakeups/op")
+}
+
+// readUnbuffered is the read path of go-steam
+func readUnbuffered(conn net.Conn, ciph cipher.Block) (*protocol.Packet, error) {
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.LittleEndian.Uint32(header))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+
+	buf, err := cryptoutil.SymmetricDecrypt(ciph, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return protocol.NewPacket(buf)
+}
+
+// testBurst returns a cipher and that many encrypted packets as sent by a CM
+func testBurst(tb testing.TB, packets int) (cipher.Block, []byte) {
+
+	ciph, err := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var msg bytes.Buffer
+	if err = protocol.NewClientMsgProtobuf(steamlang.EMsg_ClientHeartBeat, new(protobuf.CMsgClientHeartBeat)).Serialize(&msg); err != nil {
+		tb.Fatal(err)
+	}
+
+	var burst []byte
+	for range packets {
+		encrypted := cryptoutil.SymmetricEncrypt(ciph, nil, msg.Bytes())
+		burst = binary.LittleEndian.AppendUint32(burst, uint32(len(encrypted)))
+		burst = binary.LittleEndian.AppendUint32(burst, tcpConnectionMagic)
+		burst = append(burst, encrypted...)
+	}
+
+	return ciph, burst
+}
+
+type readerConn struct {
+	net.Conn
+	io.Reader
+}
+
+func (c *readerConn) Read(b []byte) (int, error) {
+	return c.Reader.Read(b)
+}
@@ -1,5 +1,11 @@
 package inspect
 
+import "errors"
+
+// ErrNotLeased is returned by a TokenDB shared by several instances for accounts another instance holds.
+// The Handler disables such bots instead of logging them in, which would kick the other session.
+var ErrNotLeased = errors.New("account leased by another instance")
+
 type TokenDB interface {
 	GetToken(string) (string, error)
 	SetToken(string, string) error
@@ -13,3 +19,19 @@ func (s *StubDB) GetToken(name string) (string, error) {
 func (s *StubDB) SetToken(name, token string) error {
 	return nil
 }
+
+// DirectoryStore persists the CM list of the Steam directory,
+// so the Handler can start when the Steam Web API is unreachable
+type DirectoryStore interface {
+	GetCMList() (*CMList, error)
+	SetCMList(*CMList) error
+}
+
+type StubDirectoryStore struct{}
+
+func (s *StubDirectoryStore) GetCMList() (*CMList, error) {
+	return nil, nil
+}
+func (s *StubDirectoryStore) SetCMList(*CMList) error {
+	return nil
+}
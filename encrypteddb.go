@@ -0,0 +1,161 @@
+package inspect
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const encryptedTokenPrefix = "enc1:"
+
+// EncryptedTokenDB wraps a TokenDB and encrypts the tokens at rest with AES-256-GCM.
+// The first key encrypts, all keys decrypt, so keys can be rotated by putting the new one in front.
+// Tokens encrypted with an older key, or stored in plaintext before, are encrypted with the current key once read.
+// The name of the bot is authenticated along with the token, so tokens can't be swapped between accounts.
+type EncryptedTokenDB struct {
+	db   TokenDB
+	keys []tokenKey // The first one is current
+}
+
+type tokenKey struct {
+	id   string // Fingerprint stored with the token to find the key
+	aead cipher.AEAD
+}
+
+// NewEncryptedTokenDB creates an EncryptedTokenDB over db, keys are 32 bytes, the first one is current
+func NewEncryptedTokenDB(db TokenDB, keys ...[]byte) (*EncryptedTokenDB, error) {
+
+	if len(keys) == 0 {
+		return nil, errors.New("no key")
+	}
+
+	e := &EncryptedTokenDB{db: db}
+	for _, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key has %d bytes, need 32", len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		e.keys = append(e.keys, tokenKey{id: hex.EncodeToString(sum[:4]), aead: aead})
+	}
+
+	return e, nil
+}
+
+func (e *EncryptedTokenDB) GetToken(name string) (string, error) {
+
+	value, err := e.db.GetToken(name)
+	if err != nil || value == "" {
+		return value, err
+	}
+
+	// Plaintext from before the encryption, if it fails it is encrypted on the next read
+	if !strings.HasPrefix(value, encryptedTokenPrefix) {
+		_ = e.SetToken(name, value)
+		return value, nil
+	}
+
+	id, data, ok := strings.Cut(value[len(encryptedTokenPrefix):], ":")
+	if !ok {
+		return "", errors.New("malformed encrypted token")
+	}
+
+	for i, key := range e.keys {
+		if key.id != id {
+			continue
+		}
+
+		token, err := decryptToken(key.aead, name, data)
+		if err != nil {
+			return "", err
+		}
+
+		// Rotate
+		if i != 0 {
+			_ = e.SetToken(name, token)
+		}
+		return token, nil
+	}
+
+	return "", fmt.Errorf("no key %s to decrypt the token", id)
+}
+
+func (e *EncryptedTokenDB) SetToken(name, token string) error {
+
+	// Keep clearing tokens recognizable
+	if token == "" {
+		return e.db.SetToken(name, "")
+	}
+
+	key := e.keys[0]
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(token)+key.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := key.aead.Seal(nonce, nonce, []byte(token), []byte(name))
+
+	return e.db.SetToken(name, encryptedTokenPrefix+key.id+":"+base64.RawStdEncoding.EncodeToString(sealed))
+}
+
+func decryptToken(aead cipher.AEAD, name, data string) (string, error) {
+
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted token")
+	}
+
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// LoadTokenKeys reads the keys of an EncryptedTokenDB from the environment variable, or the file if it is not set.
+// Keys are base64 or hex encoded and separated by commas or newlines, the current key first.
+func LoadTokenKeys(env, file string) ([][]byte, error) {
+
+	value := os.Getenv(env)
+	if value == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value = string(data)
+	}
+
+	var keys [][]byte
+	for _, s := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' '
+	}) {
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+				return nil, errors.New("key is neither hex nor base64")
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no key found")
+	}
+	return keys, nil
+}
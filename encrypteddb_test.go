@@ -0,0 +1,110 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestEncryptedTokenDB(t *testing.T) {
+
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	db := memoryDB{"plain": "plaintext"}
+	old, err := NewEncryptedTokenDB(db, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = old.SetToken("bot", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(db["bot"], "token") || !strings.HasPrefix(db["bot"], encryptedTokenPrefix) {
+		t.Fatalf("token stored in plaintext: %q", db["bot"])
+	}
+	if token, err := old.GetToken("bot"); err != nil || token != "token" {
+		t.Fatalf("expected token, got %q, %v", token, err)
+	}
+
+	// Plaintext gets encrypted once read
+	if token, err := old.GetToken("plain"); err != nil || token != "plaintext" {
+		t.Fatalf("expected plaintext, got %q, %v", token, err)
+	}
+	if !strings.HasPrefix(db["plain"], encryptedTokenPrefix) {
+		t.Fatal("plaintext not encrypted")
+	}
+
+	// Tokens can't be swapped between accounts
+	db["other"] = db["bot"]
+	if _, err := old.GetToken("other"); err == nil {
+		t.Fatal("token of another account decrypted")
+	}
+	delete(db, "other")
+
+	// Rotation
+	rotated, err := NewEncryptedTokenDB(db, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := db["bot"]
+	if token, err := rotated.GetToken("bot"); err != nil || token != "token" {
+		t.Fatalf("expected token, got %q, %v", token, err)
+	}
+	if db["bot"] == before {
+		t.Fatal("token not rotated to the new key")
+	}
+
+	// The old key alone can't read it anymore
+	if _, err := old.GetToken("bot"); err == nil {
+		t.Fatal("rotated token decrypted with the old key")
+	}
+
+	// Clearing stays empty
+	if err = rotated.SetToken("bot", ""); err != nil || db["bot"] != "" {
+		t.Fatalf("expected cleared token, got %q, %v", db["bot"], err)
+	}
+
+	if _, err = NewEncryptedTokenDB(db, []byte("short")); err == nil {
+		t.Fatal("short key accepted")
+	}
+}
+
+func TestLoadTokenKeys(t *testing.T) {
+
+	key := bytes.Repeat([]byte{3}, 32)
+	t.Setenv("TEST_TOKEN_KEYS", base64.StdEncoding.EncodeToString(key)+","+fmt.Sprintf("%x", key))
+
+	keys, err := LoadTokenKeys("TEST_TOKEN_KEYS", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[0], key) || !bytes.Equal(keys[1], key) {
+		t.Fatalf("unexpected keys %x", keys)
+	}
+
+	t.Setenv("TEST_TOKEN_KEYS", "")
+	if _, err = LoadTokenKeys("TEST_TOKEN_KEYS", ""); err == nil {
+		t.Fatal("expected error without keys")
+	}
+}
+
+func TestCredentialsRedacted(t *testing.T) {
+
+	c := Credentials{Name: "bot", Password: "hunter2", SharedSecret: "c2VjcmV0"}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Info().Object("credentials", c).Msg("")
+	logger.Info().Interface("bot", NewBot(c, &logger)).Msg("")
+
+	for _, s := range []string{fmt.Sprint(c), fmt.Sprintf("%+v", c), fmt.Sprintf("%#v", c), buf.String()} {
+		if strings.Contains(s, c.Password) || strings.Contains(s, c.SharedSecret) {
+			t.Fatalf("secret not redacted: %s", s)
+		}
+	}
+}
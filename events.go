@@ -0,0 +1,61 @@
+package inspect
+
+import "time"
+
+type EventType uint8
+
+const (
+	PollerError     EventType = iota // Transient error of the poller or failure to replace it, it will be retried
+	PollerRebuilt                    // The poller failed and was replaced, bots got registered again
+	BotDisabled                      // Login failed for good, the bot won't reconnect
+	SteamOutage                      // Many bots failed at once, only a probe reconnects
+	SteamRecovered                   // The probe got ingame, all bots reconnect
+	SessionConflict                  // The account of the bot got used elsewhere
+)
+
+var eventNames = [...]string{
+	PollerError:     "PollerError",
+	PollerRebuilt:   "PollerRebuilt",
+	BotDisabled:     "BotDisabled",
+	SteamOutage:     "SteamOutage",
+	SteamRecovered:  "SteamRecovered",
+	SessionConflict: "SessionConflict",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return "Unknown"
+}
+
+// Event reports an incident of the Handler or one of its bots
+type Event struct {
+	T    EventType
+	Bot  string // Empty for Handler wide events
+	Err  error
+	Time time.Time
+}
+
+// EventHandler receives the events of a Handler, it is called synchronously and must not block
+type EventHandler interface {
+	HandleEvent(*Event)
+}
+
+type StubEvents struct{}
+
+func (s *StubEvents) HandleEvent(*Event) {
+	// No-op
+}
+
+func (h *Handler) emit(t EventType, bot *Bot, err error) {
+	event := Event{
+		T:    t,
+		Err:  err,
+		Time: time.Now(),
+	}
+	if bot != nil {
+		event.Bot = bot.Name
+	}
+	h.eventHandler.HandleEvent(&event)
+}
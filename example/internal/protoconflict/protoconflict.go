@@ -0,0 +1,11 @@
+// Package protoconflict allows tests of packages importing inspect to run, like the one of the inspect package.
+// Its import path sorts before the protobuf packages, so it initializes before go-steam registers its protobufs.
+package protoconflict
+
+import "os"
+
+func init() {
+	if os.Getenv("GOLANG_PROTOBUF_REGISTRATION_CONFLICT") == "" {
+		_ = os.Setenv("GOLANG_PROTOBUF_REGISTRATION_CONFLICT", "ignore")
+	}
+}
@@ -29,6 +29,15 @@ func main() {
 	// TokenDB to store tokens for relogin
 	var tokenDB inspect.TokenDB
 	//tokenDB, _ = tokendb.NewTokenDB("tokens.db")
+	// Share the tokens between several instances, each one leases the bots it runs
+	//sqlDB, _ := sql.Open("sqlite3", "tokens.db")
+	//sqlTokenDB, _ := tokendb.NewSQLTokenDB(sqlDB, tokendb.SQLOptions{})
+	//defer sqlTokenDB.Close()
+	//tokenDB = sqlTokenDB
+
+	// Encrypt the tokens at rest, with the keys from TOKEN_KEYS or the key file
+	//keys, _ := inspect.LoadTokenKeys("TOKEN_KEYS", "token.key")
+	//tokenDB, _ = inspect.NewEncryptedTokenDB(tokenDB, keys...)
 
 	// Metrics Logger to log inspect requests
 	var metricsLogger inspect.MetricsLogger
@@ -53,9 +62,21 @@ func main() {
 		SharedSecret: os.Getenv("BOT_SHARED_SECRET"),
 	}, &logger)
 
+	// With the SQL TokenDB, only run the bots leased to this instance and stop the ones another instance took over
+	//claimed, _ := sqlTokenDB.Claim(bot.Name)
+	//sqlTokenDB.KeepAlive(func(names []string, err error) { ... handler.RemoveBot(bot) })
+
 	handler.AddBot(bot)
 
 	http.HandleFunc("/status", status(handler))
+	http.HandleFunc("/bots", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handler.GetBotInfos())
+	})
+	http.HandleFunc("/steam", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handler.GetSteamStatus())
+	})
 	http.HandleFunc("/inspect", inspectItem(handler, &logger))
 	http.ListenAndServe("localhost:9993", nil)
 }
@@ -84,6 +105,11 @@ func inspectItem(h *inspect.Handler, logger *zerolog.Logger) func(http.ResponseW
 		logger.Debug().
 			Msg("HTTP Inspect Request")
 
+		if h.SteamDown() {
+			http.Error(w, "steam is down", http.StatusServiceUnavailable)
+			return
+		}
+
 		offset, c := h.Inspect(&request, []*types.Info{request.L[0]})
 
 		// No capacity
@@ -106,14 +132,19 @@ func inspectItem(h *inspect.Handler, logger *zerolog.Logger) func(http.ResponseW
 func status(h *inspect.Handler) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		status := h.GetBotStatus()
+		counts := h.GetBotCounts()
 
 		response := map[string]int{
-			"Bots":         status[4],
-			"DISCONNECTED": status[0],
-			"CONNECTED":    status[1],
-			"LOGGED_IN":    status[2],
-			"INGAME":       status[3],
+			"Bots":         counts.Total,
+			"DISCONNECTED": counts.Disconnected,
+			"CONNECTED":    counts.Connected,
+			"LOGGED_IN":    counts.LoggedIn,
+			"INGAME":       counts.Ingame,
+			"GC_WAITING":   counts.GCWaiting,
+			"DISABLED":     counts.Disabled,
+			"LOGIN_QUEUE":  h.GetLoginsWaiting(),
+			"CMs":          h.GetDirectoryStatus().Servers,
+			"GC_VERSION":   int(h.GCVersion()),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -4,9 +4,17 @@ import (
 	"fmt"
 	"time"
 
+	inspect "github.com/0xAozora/cs2-inspect"
 	influxdb "github.com/influxdata/influxdb-client-go/v2"
 )
 
+// InfluxDB records all optional metrics as well
+var (
+	_ inspect.PollerMetrics = (*InfluxDB)(nil)
+	_ inspect.PoolMetrics   = (*InfluxDB)(nil)
+	_ inspect.IngameMetrics = (*InfluxDB)(nil)
+)
+
 type InfluxDB struct {
 	client       influxdb.Client
 	organization string
@@ -26,3 +34,27 @@ func (db *InfluxDB) LogLookup(bot string, d time.Duration, rec *time.Time, err b
 
 	api.WriteRecord(fmt.Sprintf("lookup,bot=%s,error=%c duration=%d %d", bot, e, d.Milliseconds(), rec.UnixNano()))
 }
+
+func (db *InfluxDB) LogPollerError(rebuilt bool, rec *time.Time) {
+	api := db.client.WriteAPI(db.organization, "poller")
+
+	r := '0'
+	if rebuilt {
+		r = '1'
+	}
+
+	api.WriteRecord(fmt.Sprintf("poller_error,rebuilt=%c count=1i %d", r, rec.UnixNano()))
+}
+
+func (db *InfluxDB) LogPool(stats *inspect.PoolStats, rec *time.Time) {
+	api := db.client.WriteAPI(db.organization, "pool")
+
+	api.WriteRecord(fmt.Sprintf("pool workers=%di,busy=%di,queued=%di,panics=%di,rejected=%di %d",
+		stats.Workers, stats.Busy, stats.Queued, stats.Panics, stats.Rejected, rec.UnixNano()))
+}
+
+func (db *InfluxDB) LogIngame(bot string, d time.Duration, rec *time.Time) {
+	api := db.client.WriteAPI(db.organization, "ingame")
+
+	api.WriteRecord(fmt.Sprintf("ingame,bot=%s duration=%d %d", bot, d.Milliseconds(), rec.UnixNano()))
+}
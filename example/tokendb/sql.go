@@ -0,0 +1,265 @@
+package tokendb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	inspect "github.com/0xAozora/cs2-inspect"
+)
+
+// ErrNotLeased is returned when getting or setting the token of an account not leased by this instance
+var ErrNotLeased = inspect.ErrNotLeased
+
+// SQLTokenDB is a TokenDB over database/sql, shared by several inspect instances.
+// Accounts are leased to one instance at a time, so two instances never log in the same account.
+// An instance claims its bots, renews the leases while running and releases them on Close.
+// It is tested with SQLite, and uses placeholders of PostgreSQL if Postgres is set.
+// Leases are compared with the clock of each instance, which should be in sync.
+type SQLTokenDB struct {
+	db       *sql.DB
+	owner    string
+	lease    time.Duration
+	postgres bool
+
+	claimed []string
+	mutex   sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// SQLOptions are the optional settings of a SQLTokenDB
+type SQLOptions struct {
+	Owner    string        // ID of this instance, hostname and pid by default
+	Lease    time.Duration // Lease of the accounts, 1min by default
+	Postgres bool          // Use $1 placeholders
+}
+
+// NewSQLTokenDB creates the table if needed, the db is not closed by Close
+func NewSQLTokenDB(db *sql.DB, options SQLOptions) (*SQLTokenDB, error) {
+
+	if options.Owner == "" {
+		host, _ := os.Hostname()
+		options.Owner = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	if options.Lease <= 0 {
+		options.Lease = time.Minute
+	}
+
+	t := &SQLTokenDB{
+		db:       db,
+		owner:    options.Owner,
+		lease:    options.Lease,
+		postgres: options.Postgres,
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS tokens (
+		name        TEXT PRIMARY KEY,
+		token       TEXT NOT NULL DEFAULT '',
+		owner       TEXT NOT NULL DEFAULT '',
+		lease_until BIGINT NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetToken returns the token, only if this instance holds the lease of the account
+func (t *SQLTokenDB) GetToken(name string) (string, error) {
+
+	var token string
+	err := t.db.QueryRow(t.rebind(`SELECT token FROM tokens WHERE name = ? AND owner = ? AND lease_until >= ?`),
+		name, t.owner, time.Now().UnixMilli()).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotLeased
+	}
+	return token, err
+}
+
+// SetToken stores the token, unless another instance holds the lease of the account
+func (t *SQLTokenDB) SetToken(name, token string) error {
+
+	now := time.Now().UnixMilli()
+	res, err := t.db.Exec(t.rebind(`INSERT INTO tokens (name, token) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET token = excluded.token
+		WHERE tokens.owner = ? OR tokens.owner = '' OR tokens.lease_until < ?`),
+		name, token, t.owner, now)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotLeased
+	}
+	return nil
+}
+
+// Claim leases the accounts which are free, or already leased by this instance, and returns them
+func (t *SQLTokenDB) Claim(names ...string) ([]string, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	until := now.Add(t.lease).UnixMilli()
+
+	var claimed []string
+	for _, name := range names {
+
+		_, err := t.db.Exec(t.rebind(`INSERT INTO tokens (name) VALUES (?) ON CONFLICT (name) DO NOTHING`), name)
+		if err != nil {
+			return claimed, err
+		}
+
+		res, err := t.db.Exec(t.rebind(`UPDATE tokens SET owner = ?, lease_until = ?
+			WHERE name = ? AND (owner = ? OR owner = '' OR lease_until < ?)`),
+			t.owner, until, name, t.owner, now.UnixMilli())
+		if err != nil {
+			return claimed, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		claimed = append(claimed, name)
+		if !slices.Contains(t.claimed, name) {
+			t.claimed = append(t.claimed, name)
+		}
+	}
+
+	return claimed, nil
+}
+
+// Renew extends the leases of this instance and returns the accounts it lost,
+// e.g. because it couldn't renew in time and another instance claimed them
+func (t *SQLTokenDB) Renew() ([]string, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	until := time.Now().Add(t.lease).UnixMilli()
+	if _, err := t.db.Exec(t.rebind(`UPDATE tokens SET lease_until = ? WHERE owner = ?`), until, t.owner); err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db.Query(t.rebind(`SELECT name FROM tokens WHERE owner = ?`), t.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[string]struct{}, len(t.claimed))
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		owned[name] = struct{}{}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var lost []string
+	t.claimed = slices.DeleteFunc(t.claimed, func(name string) bool {
+		_, ok := owned[name]
+		if !ok {
+			lost = append(lost, name)
+		}
+		return !ok
+	})
+
+	return lost, nil
+}
+
+// Release gives up the leases of the accounts, all of them if none are given
+func (t *SQLTokenDB) Release(names ...string) error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(names) == 0 {
+		names = slices.Clone(t.claimed)
+	}
+
+	for _, name := range names {
+		_, err := t.db.Exec(t.rebind(`UPDATE tokens SET owner = '', lease_until = 0 WHERE name = ? AND owner = ?`), name, t.owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.claimed = slices.DeleteFunc(t.claimed, func(name string) bool {
+		return slices.Contains(names, name)
+	})
+
+	return nil
+}
+
+// KeepAlive renews the leases in the background until Close, lost is called with the accounts another instance took over
+func (t *SQLTokenDB) KeepAlive(lost func(names []string, err error)) {
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(t.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-t.stop:
+				return
+			}
+
+			names, err := t.Renew()
+			if len(names) != 0 || err != nil {
+				lost(names, err)
+			}
+		}
+	}()
+}
+
+// Close stops the KeepAlive and releases all accounts of this instance
+func (t *SQLTokenDB) Close() error {
+
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+
+	return t.Release()
+}
+
+// rebind replaces the ? placeholders with $n for PostgreSQL
+func (t *SQLTokenDB) rebind(query string) string {
+
+	if !t.postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
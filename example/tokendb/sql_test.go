@@ -0,0 +1,143 @@
+package tokendb
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	_ "cs2-inspect/example/internal/protoconflict"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tokens.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newSQLTokenDB(t *testing.T, db *sql.DB, owner string, lease time.Duration) *SQLTokenDB {
+	tdb, err := NewSQLTokenDB(db, SQLOptions{Owner: owner, Lease: lease})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tdb
+}
+
+func TestSQLTokenDBLease(t *testing.T) {
+
+	db := openSQLite(t)
+	a := newSQLTokenDB(t, db, "a", time.Minute)
+	b := newSQLTokenDB(t, db, "b", time.Minute)
+
+	claimed, err := a.Claim("bot1", "bot2")
+	if err != nil || !slices.Equal(claimed, []string{"bot1", "bot2"}) {
+		t.Fatalf("a claimed %v, %v", claimed, err)
+	}
+	claimed, err = b.Claim("bot2", "bot3")
+	if err != nil || !slices.Equal(claimed, []string{"bot3"}) {
+		t.Fatalf("b claimed %v, %v", claimed, err)
+	}
+
+	// Only the lease holder reads and writes the token
+	if err = a.SetToken("bot1", "token1"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := a.GetToken("bot1"); err != nil || token != "token1" {
+		t.Fatalf("expected token1, got %q, %v", token, err)
+	}
+	if token, err := b.GetToken("bot1"); !errors.Is(err, ErrNotLeased) || token != "" {
+		t.Fatalf("expected ErrNotLeased, got %q, %v", token, err)
+	}
+	if err = b.SetToken("bot1", "other"); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected ErrNotLeased, got %v", err)
+	}
+	if _, err = b.GetToken("unknown"); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected ErrNotLeased, got %v", err)
+	}
+
+	// Released accounts can be claimed by others
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = b.Claim("bot1", "bot2")
+	if err != nil || !slices.Equal(claimed, []string{"bot1", "bot2"}) {
+		t.Fatalf("b claimed %v after release, %v", claimed, err)
+	}
+	if token, _ := b.GetToken("bot1"); token != "token1" {
+		t.Fatalf("token lost on release, got %q", token)
+	}
+}
+
+func TestSQLTokenDBExpiry(t *testing.T) {
+
+	db := openSQLite(t)
+	a := newSQLTokenDB(t, db, "a", 50*time.Millisecond)
+	b := newSQLTokenDB(t, db, "b", time.Minute)
+
+	if _, err := a.Claim("bot1", "bot2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewed leases stay
+	if lost, err := a.Renew(); err != nil || len(lost) != 0 {
+		t.Fatalf("lost %v, %v", lost, err)
+	}
+
+	// a stalls, b takes over once the lease expired
+	time.Sleep(100 * time.Millisecond)
+	claimed, err := b.Claim("bot2")
+	if err != nil || !slices.Equal(claimed, []string{"bot2"}) {
+		t.Fatalf("b claimed %v, %v", claimed, err)
+	}
+
+	lost, err := a.Renew()
+	if err != nil || !slices.Equal(lost, []string{"bot2"}) {
+		t.Fatalf("expected to lose bot2, got %v, %v", lost, err)
+	}
+	if err = a.SetToken("bot2", "stale"); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected ErrNotLeased, got %v", err)
+	}
+	if _, err = a.GetToken("bot2"); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected ErrNotLeased, got %v", err)
+	}
+}
+
+func TestSQLTokenDBKeepAlive(t *testing.T) {
+
+	db := openSQLite(t)
+	a := newSQLTokenDB(t, db, "a", 60*time.Millisecond)
+	b := newSQLTokenDB(t, db, "b", time.Minute)
+
+	if _, err := a.Claim("bot1"); err != nil {
+		t.Fatal(err)
+	}
+	a.KeepAlive(func(names []string, err error) {
+		t.Errorf("lost %v, %v", names, err)
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	if claimed, _ := b.Claim("bot1"); len(claimed) != 0 {
+		t.Fatal("lease expired while kept alive")
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, _ := b.Claim("bot1"); len(claimed) != 1 {
+		t.Fatal("lease not released on close")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tdb := &SQLTokenDB{postgres: true}
+	if q := tdb.rebind(`UPDATE tokens SET owner = ? WHERE name = ?`); q != `UPDATE tokens SET owner = $1 WHERE name = $2` {
+		t.Fatalf("unexpected query %s", q)
+	}
+}
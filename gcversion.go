@@ -0,0 +1,79 @@
+package inspect
+
+import (
+	"slices"
+	"time"
+)
+
+// DefaultGCVersion is the client version sent in the hello, unless configured otherwise
+const DefaultGCVersion = 2000244
+
+// GCVersion returns the client version sent in the hello
+func (h *Handler) GCVersion() uint32 {
+	return h.gcVersion.Load()
+}
+
+// gcHelloSpacing spreads the hellos after a version change, so the GC doesn't get them all at once
+const gcHelloSpacing = 20 * time.Millisecond
+
+// SetGCVersion changes the client version sent in the hello.
+// Bots waiting for a welcome or ingame send the hello again with the new version, spread over time.
+// The GC updates it through the welcome and version updates as well.
+func (h *Handler) SetGCVersion(version uint32) {
+
+	if version == 0 {
+		return
+	}
+
+	// Only the first bot to learn about the new version triggers the hellos
+	old := h.gcVersion.Swap(version)
+	if old == version {
+		return
+	}
+
+	h.log.Info().
+		Uint32("old", old).
+		Uint32("version", version).
+		Msg("GC version updated")
+
+	h.botMutex.RLock()
+	bots := slices.Clone(h.botQueue)
+	h.botMutex.RUnlock()
+
+	now := time.Now()
+	var n int
+	for _, bot := range bots {
+		if !h.needsHello(bot) {
+			continue
+		}
+
+		h.scheduler.AddTask(&Task{
+			T: Function,
+			Value: func() {
+				// The state might have changed meanwhile
+				if !h.needsHello(bot) {
+					return
+				}
+				if err := h.sendHello(bot); err != nil {
+					h.handleError(bot, bot.conn, 0, err)
+				}
+			},
+			Time: now.Add(time.Duration(n) * gcHelloSpacing).UnixNano(),
+		})
+		n++
+	}
+}
+
+// needsHello reports whether the bot has to send the hello again after a version change
+func (h *Handler) needsHello(bot *Bot) bool {
+
+	if bot.removed.Load() || bot.yielding() {
+		return false
+	}
+
+	bot.gcMutex.Lock()
+	waiting := bot.hello != nil
+	bot.gcMutex.Unlock()
+
+	return bot.status == INGAME || bot.status == GC_WAITING || waiting
+}
@@ -0,0 +1,319 @@
+package inspect
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+// manualScheduler keeps the tasks until the test runs them
+type manualScheduler struct {
+	tasks []*manualHandle
+}
+
+type manualHandle struct {
+	s    *manualScheduler
+	task *Task
+}
+
+func (s *manualScheduler) Run(func(*Task))  {}
+func (s *manualScheduler) Stop()            {}
+func (s *manualScheduler) RemoveTask(int64) {}
+
+func (s *manualScheduler) AddTask(task *Task) TaskHandle {
+	h := &manualHandle{s: s, task: task}
+	s.tasks = append(s.tasks, h)
+	return h
+}
+
+func (h *manualHandle) Cancel() bool {
+	for i, t := range h.s.tasks {
+		if t == h {
+			h.s.tasks = append(h.s.tasks[:i], h.s.tasks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// heartbeats returns the scheduled heartbeats of the bot
+func (s *manualScheduler) heartbeats(bot *Bot) []*Task {
+	var tasks []*Task
+	for _, h := range s.tasks {
+		if h.task.T == Heartbeat && h.task.Value == bot.id {
+			tasks = append(tasks, h.task)
+		}
+	}
+	return tasks
+}
+
+// take removes the task like it is run
+func (s *manualScheduler) take(task *Task) *Task {
+	for _, h := range s.tasks {
+		if h.task == task {
+			h.Cancel()
+			return task
+		}
+	}
+	return nil
+}
+
+// writeConn records the messages written by a steam.Client
+type writeConn struct {
+	writes chan []byte
+}
+
+func (c *writeConn) Read() (*protocol.Packet, error) { select {} }
+func (c *writeConn) Close() error                    { return nil }
+func (c *writeConn) SetEncryptionKey([]byte)         {}
+func (c *writeConn) IsEncrypted() bool               { return true }
+
+func (c *writeConn) Write(message []byte) error {
+	c.writes <- bytes.Clone(message)
+	return nil
+}
+
+// newTestHandler creates a Handler through NewHandlerWithConfig, without network and with a manual scheduler
+func newTestHandler(t *testing.T, config *Config) (*Handler, *manualScheduler) {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	s := &manualScheduler{}
+	if config.Cap == 0 {
+		config.Cap = 8
+	}
+	if config.PoolSize == 0 {
+		config.PoolSize = 1
+	}
+	if config.FetchDirectory == nil {
+		config.FetchDirectory = func() (*CMList, error) { return nil, errors.New("offline") }
+	}
+	config.IgnoreProxy = true
+	if config.Poller == nil && config.NewPoller == nil {
+		config.Poller = NewGoroutinePoller()
+	}
+	config.Scheduler = s
+	config.Logger = &logger
+
+	h, err := NewHandlerWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, s
+}
+
+func newHeartbeatBot(h *Handler, name string) (*Bot, *writeConn) {
+	logger := zerolog.Nop()
+	bot := NewBot(Credentials{Name: name}, &logger)
+	conn := &writeConn{writes: make(chan []byte, 8)}
+	bot.client.Conn = conn
+
+	// Like AddBot, without connecting
+	bot.slot = h.allocSlot()
+	bot.index = len(h.botQueue)
+	h.botQueue = append(h.botQueue, bot)
+	h.nextBotID++
+	bot.id = h.nextBotID
+	bot.status = LOGGED_IN
+
+	return bot, conn
+}
+
+func expectHeartbeat(t *testing.T, conn *writeConn) {
+	t.Helper()
+	select {
+	case msg := <-conn.writes:
+		packet, err := protocol.NewPacket(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.EMsg != steamlang.EMsg_ClientHeartBeat {
+			t.Fatalf("expected heartbeat, got %s", packet.EMsg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat sent")
+	}
+}
+
+func expectNoWrite(t *testing.T, conn *writeConn) {
+	t.Helper()
+	select {
+	case <-conn.writes:
+		t.Fatal("unexpected write")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHeartbeatPerBotInterval(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	a, connA := newHeartbeatBot(h, "a")
+	b, connB := newHeartbeatBot(h, "b")
+
+	h.startHeartbeat(a, 5*time.Second)
+	h.startHeartbeat(b, 20*time.Second)
+
+	for _, c := range []struct {
+		bot      *Bot
+		conn     *writeConn
+		interval time.Duration
+	}{{a, connA, 5 * time.Second}, {b, connB, 20 * time.Second}} {
+
+		tasks := s.heartbeats(c.bot)
+		if len(tasks) != 1 {
+			t.Fatalf("expected 1 heartbeat for %s, got %d", c.bot.Name, len(tasks))
+		}
+
+		task := s.take(tasks[0])
+		last := task.Time
+		h.handleTask(task)
+		expectHeartbeat(t, c.conn)
+
+		// Rescheduled with the interval of this bot
+		tasks = s.heartbeats(c.bot)
+		if len(tasks) != 1 || tasks[0].Time-last != int64(c.interval) {
+			t.Fatalf("heartbeat of %s not rescheduled after %s", c.bot.Name, c.interval)
+		}
+	}
+}
+
+func TestHeartbeatDefaultInterval(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, _ := newHeartbeatBot(h, "bot")
+
+	before := time.Now()
+	h.startHeartbeat(bot, 0)
+
+	tasks := s.heartbeats(bot)
+	if len(tasks) != 1 || tasks[0].Time < before.Add(defaultHeartbeatInterval).UnixNano() {
+		t.Fatal("heartbeat not scheduled with the default interval")
+	}
+}
+
+func TestHeartbeatSameName(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	a, _ := newHeartbeatBot(h, "bot")
+	b, connB := newHeartbeatBot(h, "bot")
+
+	h.startHeartbeat(a, 5*time.Second)
+	h.startHeartbeat(b, 5*time.Second)
+
+	// Stopping one must not stop the other
+	h.removeHeartbeat(a)
+	if len(s.heartbeats(a)) != 0 {
+		t.Fatal("heartbeat not cancelled")
+	}
+
+	tasks := s.heartbeats(b)
+	if len(tasks) != 1 {
+		t.Fatal("heartbeat of the other bot cancelled")
+	}
+	h.handleTask(s.take(tasks[0]))
+	expectHeartbeat(t, connB)
+}
+
+func TestHeartbeatRelogin(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	h.startHeartbeat(bot, 5*time.Second)
+	stale := s.take(s.heartbeats(bot)[0]) // Already running when the bot logs in again
+
+	h.startHeartbeat(bot, 10*time.Second)
+	if len(s.heartbeats(bot)) != 1 {
+		t.Fatal("expected a single heartbeat")
+	}
+
+	// The task of the previous session stops without sending or rescheduling
+	h.handleTask(stale)
+	expectNoWrite(t, conn)
+	if len(s.heartbeats(bot)) != 1 {
+		t.Fatal("stale heartbeat rescheduled")
+	}
+}
+
+func TestHeartbeatStopWhileRunning(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	h.startHeartbeat(bot, 5*time.Second)
+	running := s.take(s.heartbeats(bot)[0])
+
+	h.removeHeartbeat(bot)
+	h.handleTask(running)
+
+	expectNoWrite(t, conn)
+	if len(s.heartbeats(bot)) != 0 {
+		t.Fatal("heartbeat rescheduled after stopping")
+	}
+}
+
+func TestHeartbeatLoggedOff(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, _ := newHeartbeatBot(h, "bot")
+
+	h.startHeartbeat(bot, 5*time.Second)
+
+	var buf bytes.Buffer
+	msg := protocol.NewClientMsgProtobuf(steamlang.EMsg_ClientLoggedOff, &protobuf.CMsgClientLoggedOff{
+		Eresult: proto.Int32(int32(steamlang.EResult_ServiceUnavailable)),
+	})
+	if err := msg.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.NewPacket(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.handlePacket(bot, nil, packet)
+
+	if len(s.heartbeats(bot)) != 0 {
+		t.Fatal("heartbeat not stopped on logoff")
+	}
+}
+
+func TestHeartbeatRemoveBot(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	h.startHeartbeat(bot, 5*time.Second)
+	running := s.take(s.heartbeats(bot)[0])
+
+	if err := h.RemoveBot(bot); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.botQueue) != 0 {
+		t.Fatal("bot still queued")
+	}
+
+	h.handleTask(running)
+	expectNoWrite(t, conn)
+	if len(s.heartbeats(bot)) != 0 {
+		t.Fatal("heartbeat not stopped on removal")
+	}
+
+	// Scheduled logins and reconnects of a removed bot do nothing
+	h.loginBot(bot)
+	h.connectBot(bot)
+	expectNoWrite(t, conn)
+
+	if err := h.RemoveBot(bot); err == nil {
+		t.Fatal("bot removed twice")
+	}
+}
@@ -0,0 +1,195 @@
+package inspect
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	cs2 "github.com/0xAozora/cs2-inspect/cs2/protocol/protobuf"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/gamecoordinator"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+func expectHello(t *testing.T, conn *writeConn) {
+	t.Helper()
+	select {
+	case msg := <-conn.writes:
+		packet, err := protocol.NewPacket(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.EMsg != steamlang.EMsg_ClientToGC {
+			t.Fatalf("expected hello, got %s", packet.EMsg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no hello sent")
+	}
+}
+
+// runHello runs the scheduled watchdog of the bot
+func runHello(t *testing.T, s *manualScheduler, bot *Bot) {
+	t.Helper()
+	if bot.hello == nil {
+		t.Fatal("no hello scheduled")
+	}
+	task := s.take(bot.hello.(*manualHandle).task)
+	if task == nil {
+		t.Fatal("hello not in scheduler")
+	}
+	task.Value.(func())()
+}
+
+func TestHelloWatchdog(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.helloRetries = 3
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	if err := h.sendHello(bot); err != nil {
+		t.Fatal(err)
+	}
+	h.scheduleHello(bot, 0)
+	expectHello(t, conn)
+
+	// Unanswered hellos are sent again
+	for range h.helloRetries - 1 {
+		runHello(t, s, bot)
+		expectHello(t, conn)
+	}
+
+	// Escalate to a reconnect, the manual client has nothing to disconnect
+	bot.client.Conn = nil
+	runHello(t, s, bot)
+	if bot.status != DISCONNECTED {
+		t.Fatalf("expected DISCONNECTED, got %s", bot.status)
+	}
+	if bot.hello != nil {
+		t.Fatal("hello still scheduled")
+	}
+	if len(s.tasks) != 1 || s.tasks[0].task.T != Function {
+		t.Fatalf("expected reconnect task, got %d tasks", len(s.tasks))
+	}
+}
+
+func TestHelloWelcome(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	if err := h.sendHello(bot); err != nil {
+		t.Fatal(err)
+	}
+	h.scheduleHello(bot, 0)
+	expectHello(t, conn)
+
+	h.handleGCPacket(bot, &gamecoordinator.GCPacket{
+		AppId:   730,
+		MsgType: uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientWelcome),
+	})
+
+	if bot.status != INGAME {
+		t.Fatalf("expected INGAME, got %s", bot.status)
+	}
+	if bot.hello != nil || len(s.tasks) != 0 {
+		t.Fatal("watchdog not cancelled")
+	}
+	if bot.helloAttempts != 0 {
+		t.Fatalf("expected attempts to be reset, got %d", bot.helloAttempts)
+	}
+}
+
+func TestSetGCVersion(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.gcVersion.Store(DefaultGCVersion)
+
+	ingame, ingameConn := newHeartbeatBot(h, "ingame")
+	ingame.status = INGAME
+	waiting, waitingConn := newHeartbeatBot(h, "waiting")
+	h.scheduleHello(waiting, 0)
+	_, idleConn := newHeartbeatBot(h, "idle")
+
+	body, err := proto.Marshal(&cs2.CMsgGCClientVersionUpdated{ClientVersion: proto.Uint32(DefaultGCVersion + 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchdogs := len(s.tasks)
+	h.handleGCPacket(ingame, &gamecoordinator.GCPacket{
+		AppId:   730,
+		MsgType: uint32(cs2.EGCItemMsg_k_EMsgGCClientVersionUpdated),
+		Body:    body,
+	})
+
+	if h.GCVersion() != DefaultGCVersion+1 {
+		t.Fatalf("expected version %d, got %d", DefaultGCVersion+1, h.GCVersion())
+	}
+
+	// Scheduled one after another instead of sent right away
+	hellos := s.tasks[watchdogs:]
+	if len(hellos) != 2 || hellos[1].task.Time-hellos[0].task.Time != int64(gcHelloSpacing) {
+		t.Fatalf("expected 2 spaced hellos, got %d", len(hellos))
+	}
+	expectNoWrite(t, ingameConn)
+
+	for _, hello := range slices.Clone(hellos) {
+		s.take(hello.task).Value.(func())()
+	}
+	expectHello(t, ingameConn)
+	expectHello(t, waitingConn)
+	expectNoWrite(t, idleConn)
+
+	// The same version again changes nothing
+	h.SetGCVersion(DefaultGCVersion + 1)
+	if len(s.tasks) != watchdogs {
+		t.Fatal("hellos scheduled for the same version")
+	}
+}
+
+func TestGCConnectionStatus(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, conn := newHeartbeatBot(h, "bot")
+	bot.status = INGAME
+
+	body, err := proto.Marshal(&cs2.CMsgConnectionStatus{
+		Status:        cs2.GCConnectionStatus_GCConnectionStatus_NO_SESSION_IN_LOGON_QUEUE.Enum(),
+		QueuePosition: proto.Int32(3),
+		QueueSize:     proto.Int32(10),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.handleGCPacket(bot, &gamecoordinator.GCPacket{
+		AppId:   730,
+		MsgType: uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientConnectionStatus),
+		Body:    body,
+	})
+
+	if bot.status != GC_WAITING {
+		t.Fatalf("expected GC_WAITING, got %s", bot.status)
+	}
+	if info := h.GetBotInfos()[0]; info.Status != GC_WAITING || info.GCQueuePosition != 3 || info.GCQueueSize != 10 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if status := h.GetBotStatus(); status[LOGGED_IN] != 1 {
+		t.Fatalf("expected GC_WAITING to count as LOGGED_IN, got %v", status)
+	}
+	if counts := h.GetBotCounts(); counts.GCWaiting != 1 || counts.LoggedIn != 0 {
+		t.Fatalf("unexpected counts %+v", counts)
+	}
+
+	// Waiting bots keep sending hellos until welcomed
+	runHello(t, s, bot)
+	expectHello(t, conn)
+
+	h.handleGCPacket(bot, &gamecoordinator.GCPacket{
+		AppId:   730,
+		MsgType: uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientWelcome),
+	})
+	if bot.status != INGAME {
+		t.Fatalf("expected INGAME, got %s", bot.status)
+	}
+}
@@ -25,8 +25,13 @@ type InspectTask struct {
 // and a channel to notify when all its items is done
 // If the queue is full, it will return the number of items that could be put into the queue
 // resp is a slice of pointers to items, that will be filled with any successful inspect at the same index.
+// While Steam is down, it queues nothing, SteamDown tells it apart from a full queue.
 func (h *Handler) Inspect(req *types.Request, resp []*types.Info) (uint32, chan struct{}) {
 
+	if h.outage.Health() == SteamDown {
+		return 0, nil
+	}
+
 	var c chan struct{} = nil
 
 	h.InspectMutex.Lock()
@@ -80,19 +85,20 @@ func (h *Handler) inspectLoop() {
 			var fuse int
 			// Try and find an ingame bot
 			for {
-				if fuse > len(h.botQueue) {
+				// The queue changes as bots get added and removed
+				h.botMutex.RLock()
+				size := len(h.botQueue)
+				if fuse >= size {
+					h.botMutex.RUnlock()
 					h.log.Warn().Msg("No bots ingame")
 					break
 				}
+				index %= size
+				bot = h.botQueue[index]
+				h.botMutex.RUnlock()
 
 				fuse++
-
-				bot = h.botQueue[index]
 				index++
-				index %= len(h.botQueue)
-				if bot == nil {
-					continue
-				}
 
 				if bot.status != INGAME {
 					continue
@@ -107,13 +113,19 @@ func (h *Handler) inspectLoop() {
 				item.Time = time.Now()
 				bot.lastInspect = item.Time
 
+				// Schedule removal of timeouted item, cancelled when the response arrives
+				timeout := h.scheduler.AddTask(&Task{
+					T:     InspectTimeout,
+					Value: item.A,
+					Time:  item.Time.Add(2 * time.Second).UnixNano(),
+				})
+
 				// Map back to InspectTask
-				h.ItemMutex.Lock()
-				if _, ok := h.items[item.A]; ok {
+				if !h.items.Add(item.A, inspectTask, timeout) {
+					timeout.Cancel()
+
 					// Item already in inspect queue apparently
 					// belonging to a different InspectTask if not a bug
-					h.ItemMutex.Unlock()
-
 					h.log.Debug().
 						Str("bot", bot.Name).
 						Uint64("itemID", item.A).
@@ -126,12 +138,10 @@ func (h *Handler) inspectLoop() {
 					}
 					break
 				}
-				h.items[item.A] = inspectTask
-				h.ItemMutex.Unlock()
 
 				if err := bot.Inspect(s, item.A, item.D, m); err != nil {
 
-					conn := getTCPConn(bot.client)
+					conn := bot.conn
 
 					// Push to pool, we want to avoid stalling for the function
 					h.Pool.Schedule(func() {
@@ -139,9 +149,8 @@ func (h *Handler) inspectLoop() {
 					})
 
 					// Clean up first
-					h.ItemMutex.Lock()
-					delete(h.items, item.A)
-					h.ItemMutex.Unlock()
+					h.items.Remove(item.A)
+					timeout.Cancel()
 
 					// And finally go to the next bot
 					continue
@@ -152,13 +161,6 @@ func (h *Handler) inspectLoop() {
 					Uint64("itemID", item.A).
 					Msgf("Inspecting Item")
 
-				// Schedule removal of timeouted item
-				h.timeTree.AddTask(&Task{
-					T:     InspectTimeout,
-					Value: item.A,
-					Time:  item.Time.Add(2 * time.Second).UnixNano(),
-				})
-
 				break
 			}
 
@@ -197,12 +199,9 @@ func (h *Handler) handleInspectResponse(bot *Bot, packet *gamecoordinator.GCPack
 
 	id := *res.Iteminfo.Itemid
 
-	h.ItemMutex.Lock()
-	inspect := h.items[id]
+	inspect, timeout := h.items.Remove(id)
 	if inspect == nil {
 		// Inspect has Timeouted
-		h.ItemMutex.Unlock()
-
 		h.log.Debug().
 			Str("bot", bot.Name).
 			Uint64("itemID", id).
@@ -210,8 +209,7 @@ func (h *Handler) handleInspectResponse(bot *Bot, packet *gamecoordinator.GCPack
 
 		return
 	}
-	delete(h.items, id)
-	h.ItemMutex.Unlock()
+	timeout.Cancel()
 
 	h.log.Debug().
 		Str("bot", bot.Name).
@@ -2,15 +2,17 @@ package inspect
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	cs2 "github.com/0xAozora/cs2-inspect/cs2/protocol/protobuf"
 
-	"github.com/0xAozora/epoller"
 	"github.com/0xAozora/go-steam"
 	"github.com/0xAozora/go-steam/protocol"
 	"github.com/0xAozora/go-steam/protocol/gamecoordinator"
@@ -22,30 +24,56 @@ import (
 )
 
 type Handler struct {
-	bots     map[net.Conn]*Bot
-	botQueue []*Bot
-	botMutex sync.RWMutex // Mutex for everything above
-
-	items        map[uint64]*InspectTask // Map assetID directly to InspectTask
-	ItemMutex    sync.Mutex              // Mutex for ItemMap
-	InspectMutex sync.Mutex              // Mutex for InspectMap
+	bots      *botTable // Map file descriptor to connected Bot, lock-free for reads
+	botQueue  []*Bot    // Bots in the order they get picked for inspects
+	freeSlots []int     // Proxy and local address slots of removed bots, ascending
+	nextBotID uint64
+	botMutex  sync.RWMutex // Mutex for the queue, the slots and writes to the table
+
+	items        *itemRegistry // Map assetID directly to InspectTask
+	InspectMutex sync.Mutex    // Mutex for InspectMap
 	Pool         *Pool
 
+	// Deprecated: The items are sharded with a lock each, ItemMutex doesn't guard anything anymore
+	ItemMutex sync.Mutex
+
+	overload        OverloadPolicy
+	overloadTimeout time.Duration
+
+	reconnectBase time.Duration
+	reconnectMax  time.Duration
+
+	helloRetries int
+	gcVersion    atomic.Uint32
+
+	sessionPolicy SessionPolicy
+	sessionYield  time.Duration
+
+	tokenRenewBefore time.Duration
+
+	outage   *outageDetector
+	botCount atomic.Int32 // Bots not removed
+
+	logins        *loginAdmission
+	loginPolicies map[steamlang.EResult]LoginPolicy
+
 	c   chan *InspectTask // Channel for Inspect Requests
 	len uint32            // Inspects in flight
 	cap uint32            // Capacity of Inspects
 
-	// TimeTree
-	timeTree *TimeTree
+	// TimeTree or TimingWheel
+	scheduler Scheduler
 
 	//Heartbeat
-	heartbeatInterval int32
-	heartbeats        map[string]int64 // Map BotName to Next Heartbeat
-	heartbeatMutex    sync.Mutex       // Mutex for the map
+	heartbeats     map[uint64]*heartbeat // Map Bot ID to scheduled Heartbeat
+	heartbeatMutex sync.Mutex            // Mutex for the map
 
-	epoll epoller.Poller
+	poller    ConnPoller // Guarded by botMutex, except in handleClients which is the only one replacing it
+	newPoller func() (ConnPoller, error)
+	connKeyed bool // The poller keys connections on the net.Conn, bots are registered without file descriptor
 
 	metricsLogger MetricsLogger
+	eventHandler  EventHandler
 	tokenDB       TokenDB
 
 	log *zerolog.Logger
@@ -53,13 +81,37 @@ type Handler struct {
 	// Custom AuthenticationHandler
 	authenticationHandler AuthenticationHandler
 
+	transport Transport
+	cms       *CMSelector
+	directory steamDirectory
+
 	// Proxy
-	proxyList   *ProxyList
-	ignoreProxy bool
+	proxyList     *ProxyList
+	localAddrList *LocalAddrList
+	ignoreProxy   bool
 }
 
 // NewHandler creates a new Handler instance
 func NewHandler(len, cap, poolsize int, proxyList *ProxyList, ignoreProxy bool, auth AuthenticationHandler, tokenDB TokenDB, logger *zerolog.Logger, metricsLogger MetricsLogger) (*Handler, error) {
+	return NewHandlerWithConfig(&Config{
+		Len:           len,
+		Cap:           cap,
+		PoolSize:      poolsize,
+		ProxyList:     proxyList,
+		IgnoreProxy:   ignoreProxy,
+		Auth:          auth,
+		TokenDB:       tokenDB,
+		Logger:        logger,
+		MetricsLogger: metricsLogger,
+	})
+}
+
+// NewHandlerWithConfig creates a new Handler instance from a Config
+func NewHandlerWithConfig(config *Config) (*Handler, error) {
+
+	len, cap, poolsize := config.Len, config.Cap, config.PoolSize
+	proxyList, ignoreProxy := config.ProxyList, config.IgnoreProxy
+	tokenDB, metricsLogger, logger := config.TokenDB, config.MetricsLogger, config.Logger
 
 	if tokenDB == nil {
 		tokenDB = &StubDB{}
@@ -71,54 +123,168 @@ func NewHandler(len, cap, poolsize int, proxyList *ProxyList, ignoreProxy bool,
 		l := zerolog.New(zerolog.NewConsoleWriter())
 		logger = &l
 	}
+	directoryStore := config.DirectoryStore
+	if directoryStore == nil {
+		directoryStore = &StubDirectoryStore{}
+	}
+	fetchDirectory := config.FetchDirectory
+	if fetchDirectory == nil {
+		fetchDirectory = fetchSteamDirectory
+	}
 	if proxyList == nil {
-		if !ignoreProxy {
+		if !ignoreProxy && config.LocalAddrList == nil {
 			return nil, errors.New("proxy list is nil")
 		}
 		proxyList = &ProxyList{}
 	}
 
-	epoll, err := epoller.NewPoller(poolsize, 0)
-	if err != nil {
-		return nil, err
+	// There is no built-in list of WebSocket CMs, they come from the Steam directory
+	var cms *CMSelector
+	if config.Transport == WebSocket {
+		cms = NewCMSelector(nil)
+	} else {
+		cms = NewCMSelector(steam.CMServers)
 	}
 
-	timeTree := NewTimeTree()
+	eventHandler := config.EventHandler
+	if eventHandler == nil {
+		eventHandler = &StubEvents{}
+	}
+
+	newPoller := config.NewPoller
+	if newPoller == nil {
+		newPoller = func() (ConnPoller, error) {
+			poller, err := NewEpollPoller(poolsize)
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Msg("Epoll unavailable, falling back to goroutine poller")
+
+				return NewGoroutinePoller(), nil
+			}
+			return poller, nil
+		}
+	}
+
+	poller := config.Poller
+	if poller == nil {
+		var err error
+		if poller, err = newPoller(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Bots are keyed on their ID instead of the file descriptor then, which the replacement has to support as well
+	if config.NewPoller == nil && connKeyed(poller) {
+		newPoller = func() (ConnPoller, error) {
+			return NewGoroutinePoller(), nil
+		}
+	}
+
+	helloRetries := config.HelloRetries
+	if helloRetries <= 0 {
+		helloRetries = 5
+	}
+
+	sessionYield := config.SessionYield
+	if sessionYield <= 0 {
+		sessionYield = defaultSessionYield
+	}
+
+	tokenRenewBefore := config.TokenRenewBefore
+	if tokenRenewBefore <= 0 {
+		tokenRenewBefore = defaultTokenRenewBefore
+	}
+
+	overloadTimeout := config.OverloadTimeout
+	if overloadTimeout <= 0 {
+		overloadTimeout = 100 * time.Millisecond
+	}
+
+	scheduler := config.Scheduler
+	if scheduler == nil {
+		scheduler = NewTimeTree()
+	}
 
 	handler := Handler{
-		bots:     make(map[net.Conn]*Bot),
-		botQueue: make([]*Bot, 0, len),
-		items:    make(map[uint64]*InspectTask),
-		epoll:    epoll,
-		tokenDB:  tokenDB,
+		bots:      newBotTable(len),
+		botQueue:  make([]*Bot, 0, len),
+		items:     newItemRegistry(),
+		poller:    poller,
+		newPoller: newPoller,
+		connKeyed: connKeyed(poller),
+		tokenDB:   tokenDB,
 
-		timeTree:          timeTree,
-		heartbeatInterval: 9, // Just in case steam returns 0
-		heartbeats:        make(map[string]int64),
+		scheduler:  scheduler,
+		heartbeats: make(map[uint64]*heartbeat),
 
 		c:   make(chan *InspectTask, cap-len),
 		cap: uint32(cap),
 
-		authenticationHandler: auth,
+		authenticationHandler: config.Auth,
 		metricsLogger:         metricsLogger,
+		eventHandler:          eventHandler,
 		log:                   logger,
 
-		Pool: NewPool(poolsize, poolsize, 10),
+		Pool:             NewPool(poolsize, poolsize, 10),
+		overload:         config.Overload,
+		overloadTimeout:  overloadTimeout,
+		reconnectBase:    config.ReconnectBase,
+		reconnectMax:     config.ReconnectMax,
+		helloRetries:     helloRetries,
+		sessionPolicy:    config.SessionPolicy,
+		sessionYield:     sessionYield,
+		tokenRenewBefore: tokenRenewBefore,
+		outage:           newOutageDetector(config.OutageWindow, config.OutageThreshold, config.OutageMinBots),
+
+		transport: config.Transport,
+		cms:       cms,
+		directory: steamDirectory{fetch: fetchDirectory, store: directoryStore},
+
+		proxyList:     proxyList,
+		localAddrList: config.LocalAddrList,
+		ignoreProxy:   ignoreProxy,
+	}
+
+	gcVersion := config.GCVersion
+	if gcVersion == 0 {
+		gcVersion = DefaultGCVersion
+	}
+	handler.gcVersion.Store(gcVersion)
+
+	handler.loginPolicies = DefaultLoginPolicies()
+	for result, policy := range config.LoginPolicies {
+		handler.loginPolicies[result] = policy
+	}
+
+	handler.logins = newLoginAdmission(scheduler, handler.loginBot, config.LoginInterval, config.RegionLoginInterval)
 
-		proxyList:   proxyList,
-		ignoreProxy: ignoreProxy,
+	handler.Pool.PanicHandler = func(v any, stack []byte) {
+		logger.Error().
+			Interface("panic", v).
+			Str("stack", string(stack)).
+			Msg("Recovered panic in pool")
 	}
 
-	go timeTree.Run(handler.handleTask)
+	go scheduler.Run(handler.handleTask)
 
-	initializeSteamDirectory(logger)
+	// Only wait for the refresh if we don't have a cached list to start with
+	if handler.loadSteamDirectory() {
+		go handler.refreshSteamDirectory()
+	} else {
+		handler.refreshSteamDirectory()
+	}
 	go func() {
 		for {
 			time.Sleep(time.Hour)
-			initializeSteamDirectory(logger)
+			handler.refreshSteamDirectory()
 		}
 	}()
 
+	if m, ok := metricsLogger.(PoolMetrics); ok {
+		go handler.logPoolStats(m)
+	}
+
 	go handler.handleClients()
 
 	go handler.inspectLoop()
@@ -132,16 +298,28 @@ func (h *Handler) AddBot(bot *Bot) error {
 	if bot == nil {
 		return errors.New("bot is nil")
 	}
+	// A removed Bot keeps its state, e.g. disabled, so it has to be replaced by a new one
+	if bot.id != 0 {
+		return errors.New("bot already added")
+	}
 
 	// Make sure bot has a logger, else use default logger of the handler
 	if bot.log == nil {
 		bot.log = h.log
 	}
+	bot.transport = h.transport
+	bot.cms = h.cms
+	bot.backoff.Base = h.reconnectBase
+	bot.backoff.Max = h.reconnectMax
 
 	h.botMutex.Lock()
+	bot.slot = h.allocSlot()
+	bot.index = len(h.botQueue)
 	h.botQueue = append(h.botQueue, bot)
-	bot.index = len(h.botQueue) - 1
+	h.nextBotID++
+	bot.id = h.nextBotID
 	h.botMutex.Unlock()
+	h.botCount.Add(1)
 
 	// Connect
 	h.Pool.Schedule(func() {
@@ -151,68 +329,224 @@ func (h *Handler) AddBot(bot *Bot) error {
 	return nil
 }
 
+// RemoveBot disconnects the bot and removes it from the Handler, it won't reconnect anymore
+func (h *Handler) RemoveBot(bot *Bot) error {
+
+	h.botMutex.Lock()
+	if bot == nil || bot.index >= len(h.botQueue) || h.botQueue[bot.index] != bot {
+		h.botMutex.Unlock()
+		return errors.New("bot not found")
+	}
+	h.botQueue = slices.Delete(h.botQueue, bot.index, bot.index+1)
+	for _, b := range h.botQueue[bot.index:] {
+		b.index--
+	}
+	h.freeSlot(bot.slot)
+	bot.removed.Store(true)
+
+	connected := h.bots.Delete(bot.fd, bot)
+	if connected {
+		_ = h.poller.Remove(bot.polled.Swap(nil), bot.fd)
+	}
+	h.botMutex.Unlock()
+
+	h.botCount.Add(-1)
+	h.forgetBot(bot)
+
+	h.removeHeartbeat(bot)
+	bot.cancelHello()
+	bot.cancelReclaim()
+	bot.cancelRenewal()
+
+	if connected {
+		bot.client.Disconnect()
+	}
+	bot.status = DISCONNECTED
+
+	h.log.Info().
+		Str("bot", bot.Name).
+		Msg("Removed")
+
+	return nil
+}
+
+// allocSlot returns the lowest free proxy and local address slot, botMutex must be held
+func (h *Handler) allocSlot() int {
+	if len(h.freeSlots) == 0 {
+		// All slots below are taken
+		return len(h.botQueue)
+	}
+	slot := h.freeSlots[0]
+	h.freeSlots = h.freeSlots[1:]
+	return slot
+}
+
+// freeSlot makes the slot of a removed bot available for the next one, botMutex must be held
+func (h *Handler) freeSlot(slot int) {
+	i, _ := slices.BinarySearch(h.freeSlots, slot)
+	h.freeSlots = slices.Insert(h.freeSlots, i, slot)
+}
+
 // When we encounter an error, we won't try connecting again (except the Connect function)
 func (h *Handler) connectBot(bot *Bot) {
 
-	// Usually sticky IP is determined on unique password, while proxy IP and username can be the same
-	// So we use the password slice as an identifier if we have enough unique proxies
-	if bot.index > len(h.proxyList.Passwords)-1 {
-		h.log.Warn().
-			Str("bot", bot.Name).
-			Msg("No Proxy available for this Bot")
+	if bot.removed.Load() {
+		return
+	}
 
-		if !h.ignoreProxy {
-			return
+	dialer, ok := h.botDialer(bot)
+	if !ok {
+		return
+	}
+
+	// Retried with the backoff of the bot, unless Steam is down
+	conn, err := bot.Connect(dialer)
+	if err != nil {
+		if errors.Is(err, errCMClosed) {
+			h.steamFailure(bot, err)
 		}
+		h.handleError(bot, nil, 0, err)
+		return
+	}
 
-		conn := bot.Connect(nil)
-		_ = h.epoll.Add(conn, bot.fd)
+	if bot.fd, err = h.pollKey(bot, conn); err != nil {
+		bot.client.Disconnect()
+		bot.status = DISCONNECTED
+		h.log.Err(err).
+			Str("bot", bot.Name).
+			Msg("Can't use the connection of this Bot")
+		return
+	}
 
-		h.botMutex.Lock()
-		h.bots[conn] = bot
+	// Register under lock, so a rebuild of the poller can't miss the bot
+	h.botMutex.Lock()
+	if bot.removed.Load() {
+		// Removed while connecting
+		h.botMutex.Unlock()
+		bot.client.Disconnect()
+		bot.status = DISCONNECTED
+		return
+	}
+	polled := bot.pollConn(bot.fd)
+	if err = h.poller.Add(polled, bot.fd); err != nil {
 		h.botMutex.Unlock()
+		h.handleError(bot, conn, 0, err)
 		return
 	}
+	bot.polled.Store(polled)
+	h.bots.Store(bot.fd, bot)
+	h.botMutex.Unlock()
+
+	// There is no channel encryption over WebSockets
+	if bot.transport == WebSocket {
+		h.logins.Admit(bot)
+	}
+}
+
+// pollKey returns the key of the connection in the poller and the bot table,
+// the file descriptor, or the ID of the bot if the poller doesn't need one.
+// A connection without file descriptor can't be polled otherwise, retrying won't change that.
+func (h *Handler) pollKey(bot *Bot, conn net.Conn) (uint64, error) {
+	if h.connKeyed {
+		return bot.id, nil
+	}
+	return pollFD(conn)
+}
+
+// botDialer returns the dialer for this bot, a nil dialer connects directly
+// Proxy and local address are both sticky to the bot slot and can be combined,
+// in which case the connection to the proxy is bound to the local address
+func (h *Handler) botDialer(bot *Bot) (proxy.Dialer, bool) {
+
+	forward := &net.Dialer{Timeout: 10 * time.Second}
+
+	var bound bool
+	if h.localAddrList != nil {
+		if addr := h.localAddrList.Get(bot.slot); addr != nil {
+			forward.LocalAddr = addr
+			region := addr.IP.String()
+			bot.region.Store(&region)
+			bound = true
+		} else {
+			h.log.Warn().
+				Str("bot", bot.Name).
+				Msg("No local address available for this Bot")
+		}
+	}
+
+	// Usually sticky IP is determined on unique password, while proxy IP and username can be the same
+	// So we use the password slice as an identifier if we have enough unique proxies
+	if bot.slot > len(h.proxyList.Passwords)-1 {
+
+		if bound {
+			return forward, true
+		}
+
+		h.log.Warn().
+			Str("bot", bot.Name).
+			Msg("No Proxy available for this Bot")
+
+		return nil, h.ignoreProxy
+	}
 
 	var addr string
 	if h.proxyList.Address != "" {
 		addr = h.proxyList.Address
 	} else {
-		addr = h.proxyList.Addresses[bot.index]
+		addr = h.proxyList.Addresses[bot.slot]
 	}
 
 	var user string
 	if h.proxyList.Username != "" {
 		user = h.proxyList.Username
 	} else {
-		user = h.proxyList.Usernames[bot.index]
+		user = h.proxyList.Usernames[bot.slot]
 	}
 
-	dialer, err := proxy.SOCKS5("tcp", addr, &proxy.Auth{User: user, Password: h.proxyList.Passwords[bot.index]}, &net.Dialer{Timeout: 10 * time.Second})
+	password := h.proxyList.Passwords[bot.slot]
+	region := proxyRegion(addr, user, password)
+	bot.region.Store(&region)
+
+	dialer, err := proxy.SOCKS5("tcp", addr, &proxy.Auth{User: user, Password: password}, forward)
 	if err != nil {
 		h.log.Err(err).
 			Str("bot", bot.Name).
 			Str("proxy", addr).
 			Msg("Error creating proxy dialer")
-		return
+		return nil, false
 	}
 
-	conn := bot.Connect(dialer)
-	_ = h.epoll.Add(conn, bot.fd)
-
-	h.botMutex.Lock()
-	h.bots[conn] = bot
-	h.botMutex.Unlock()
+	return dialer, true
 }
 
 func (h *Handler) loginBot(bot *Bot) {
 
-	token, _ := h.tokenDB.GetToken(bot.Name)
-	if token != "" {
-		bot.Login(token, nil)
+	if bot.removed.Load() {
 		return
 	}
 
+	token, err := h.tokenDB.GetToken(bot.Name)
+	if err != nil {
+		h.tokenError(bot, bot.conn, err)
+		return
+	}
+
+	if token != "" {
+		if h.trackToken(bot, token) {
+			bot.Login(token, nil)
+			return
+		}
+
+		// Save Steam the round trip to tell us
+		h.log.Warn().
+			Str("bot", bot.Name).
+			Msg("Refresh token expired")
+		if err = h.tokenDB.SetToken(bot.Name, ""); err != nil {
+			h.tokenError(bot, bot.conn, err)
+			return
+		}
+	}
+
 	var steamAuthenticator steam.Authenticator
 	if bot.SharedSecret != "" {
 		steamAuthenticator = &TwoFactorAuthenticator{bot: bot}
@@ -235,30 +569,28 @@ func (h *Handler) handleTask(task *Task) {
 	// Heartbeat
 	case Heartbeat:
 
-		now := time.Now().UnixNano()
-
-		index := task.Value.(int)
-		bot := h.botQueue[index]
-
-		h.log.Debug().
-			Str("bot", bot.Name).
-			Msg("Heartbeat")
+		id := task.Value.(uint64)
 
+		// The task of a previous session might have been running while it got cancelled
 		h.heartbeatMutex.Lock()
-		next, ok := h.heartbeats[bot.Name]
-		if !ok || next > now {
+		hb := h.heartbeats[id]
+		if hb == nil || hb.task != task {
 			h.heartbeatMutex.Unlock()
 
 			h.log.Debug().
-				Str("bot", bot.Name).
-				Bool("ok", ok).
-				Int64("next", next).
-				Int64("now", now).
+				Uint64("id", id).
+				Bool("ok", hb != nil).
 				Msg("Stopping Heartbeat")
 
 			return
 		}
 
+		bot := hb.bot
+
+		h.log.Debug().
+			Str("bot", bot.Name).
+			Msg("Heartbeat")
+
 		h.Pool.Schedule(func() {
 			err := bot.client.Write(protocol.NewClientMsgProtobuf(steamlang.EMsg_ClientHeartBeat, new(protobuf.CMsgClientHeartBeat)))
 			if err != nil {
@@ -269,27 +601,21 @@ func (h *Handler) handleTask(task *Task) {
 		//time.Sleep(1 * time.Second) // When making changes, make sure to sleep when testing to not spam the servers in case something goes wrong
 
 		// Add back the same task with next heartbeat time
-		task.Time += int64(h.heartbeatInterval) * int64(time.Second)
-		h.timeTree.AddTask(task)
-
-		h.heartbeats[bot.Name] = task.Time
+		task.Time += int64(hb.interval)
+		hb.handle = h.scheduler.AddTask(task)
 
 		h.heartbeatMutex.Unlock()
 
 	// Check inspect timeout
 	case InspectTimeout:
 		assetid := task.Value.(uint64)
-		h.ItemMutex.Lock()
-		inspectTask := h.items[assetid]
 		// TODO: Implement InspectTask Context and retry if doable in time
-		if inspectTask != nil {
+		if inspectTask, _ := h.items.Remove(assetid); inspectTask != nil {
 			new := atomic.AddUint32(&inspectTask.Remaining, ^uint32(0))
 			if new == 0 {
 				inspectTask.Ret <- struct{}{}
 			}
-			delete(h.items, assetid)
 		}
-		h.ItemMutex.Unlock()
 
 	// Scheduled function
 	case Function:
@@ -301,37 +627,211 @@ func (h *Handler) handleClients() {
 
 	var conns []net.Conn
 	var err error
+	var failures int
 	for {
 
-		conns, err = h.epoll.Wait(100)
+		conns, err = h.poller.Wait(100)
 		if err != nil {
-			h.log.Fatal().Err(err).Msg("Epoll Error")
-		}
 
-		for _, conn := range conns {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+
+			failures++
+			if failures <= pollerRetries && isTransient(err) {
+				h.log.Warn().
+					Err(err).
+					Int("failures", failures).
+					Msg("Poller Error")
 
-			h.botMutex.RLock()
-			bot := h.bots[conn]
-			h.botMutex.RUnlock()
+				h.logPollerError(false)
+				h.emit(PollerError, nil, err)
 
-			// Avoid Read of Broken Connection
-			if bot == nil {
+				time.Sleep(time.Duration(failures) * pollerRetryDelay)
 				continue
 			}
 
-			packet, err := bot.client.Read()
-			if err != nil {
-				h.handleError(bot, conn, 0, err)
+			if err = h.rebuildPoller(err); err != nil {
+				// Keep waiting on the failed poller, it keeps failing until we manage to replace it
+				time.Sleep(min(time.Duration(failures)*pollerRetryDelay, time.Second))
+				continue
+			}
+			failures = 0
+			continue
+		}
+		failures = 0
+
+		for _, c := range conns {
+
+			fc, ok := c.(*fdConn)
+			if !ok {
 				continue
 			}
 
-			h.Pool.Schedule(func() {
-				h.handlePacket(bot, conn, packet)
-			})
+			// Avoid Read of Broken Connection, the fd might have been reused by another bot already,
+			// or the bot reconnected meanwhile
+			bot := h.bots.Load(fc.fd)
+			if bot == nil || bot.polled.Load() != fc {
+				continue
+			}
+			conn := fc.Conn
+
+			// Read until the connection has nothing buffered anymore
+			for {
+				packet, err := bot.client.Read()
+				if err != nil {
+					// Unless we dropped the connection meanwhile, only the CM closing it counts, not the proxy or network breaking it
+					if bot.polled.Load() == fc && closedByCM(err) {
+						h.steamFailure(bot, err)
+					}
+					h.handleError(bot, conn, 0, err)
+					break
+				}
+
+				h.dispatchPacket(bot, conn, packet)
+
+				if !bot.pending() {
+					break
+				}
+			}
 		}
 	}
 }
 
+const (
+	pollerRetries    = 5
+	pollerRetryDelay = 10 * time.Millisecond
+)
+
+// isTransient reports whether a poller error is worth retrying on the same poller
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOMEM) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// rebuildPoller replaces a failed poller and registers all connected bots again
+// It returns an error if no replacement could be created, the old poller is kept then
+func (h *Handler) rebuildPoller(cause error) error {
+
+	h.log.Error().
+		Err(cause).
+		Msg("Poller failed, rebuilding")
+
+	poller, err := h.newPoller()
+	if err == nil && h.connKeyed && !connKeyed(poller) {
+		_ = poller.Close()
+		err = errors.New("replacement poller needs file descriptors, the bots are registered without")
+	}
+	if err != nil {
+		h.log.Err(err).Msg("Error creating poller")
+
+		h.logPollerError(false)
+		h.emit(PollerError, nil, err)
+		return err
+	}
+
+	type failed struct {
+		bot  *Bot
+		conn net.Conn
+		err  error
+	}
+	var failures []failed
+
+	h.botMutex.Lock()
+	old := h.poller
+	h.bots.Range(func(fd uint64, bot *Bot) bool {
+		polled := bot.pollConn(fd)
+		if err := poller.Add(polled, fd); err != nil {
+			bot.polled.Store(nil)
+			failures = append(failures, failed{bot, bot.conn, err})
+			return true
+		}
+		bot.polled.Store(polled)
+		return true
+	})
+	h.poller = poller
+	h.botMutex.Unlock()
+
+	_ = old.Close()
+
+	// Reconnect whoever we couldn't register
+	for _, f := range failures {
+		h.Pool.Schedule(func() {
+			h.handleError(f.bot, f.conn, 0, f.err)
+		})
+	}
+
+	h.log.Info().
+		Int("failed", len(failures)).
+		Msg("Poller rebuilt")
+
+	h.logPollerError(true)
+	h.emit(PollerRebuilt, nil, cause)
+
+	return nil
+}
+
+// disableBot disconnects the bot for good, it needs to be removed and replaced by a new Bot after fixing its account
+func (h *Handler) disableBot(bot *Bot, conn net.Conn, err error) {
+
+	bot.disabledReason = err.Error()
+	bot.disabled.Store(true)
+
+	h.log.Error().
+		Err(err).
+		Str("bot", bot.Name).
+		Msg("Disabling Bot")
+
+	h.emit(BotDisabled, bot, err)
+
+	h.handleError(bot, conn, 0, err)
+}
+
+// tokenError handles the TokenDB failing before a login.
+// Accounts leased by another instance are disabled, the bot reconnects on other errors.
+func (h *Handler) tokenError(bot *Bot, conn net.Conn, err error) {
+
+	if errors.Is(err, ErrNotLeased) {
+		h.disableBot(bot, conn, err)
+		return
+	}
+	h.handleError(bot, conn, 0, fmt.Errorf("token db: %w", err))
+}
+
+// dispatchPacket hands the packet to the pool according to the overload policy
+func (h *Handler) dispatchPacket(bot *Bot, conn net.Conn, packet *protocol.Packet) {
+
+	task := func() {
+		h.handlePacket(bot, conn, packet)
+	}
+
+	switch h.overload {
+	case OverloadCallerRuns:
+		if !h.Pool.TrySchedule(task) {
+			task()
+		}
+	case OverloadDrop:
+		if err := h.Pool.ScheduleTimeout(h.overloadTimeout, task); err != nil {
+			h.log.Warn().
+				Str("bot", bot.Name).
+				Str("emsg", packet.EMsg.String()).
+				Msg("Pool overloaded, dropping packet")
+		}
+	default:
+		h.Pool.Schedule(task)
+	}
+}
+
+const poolStatsInterval = 10 * time.Second
+
+func (h *Handler) logPoolStats(m PoolMetrics) {
+	for {
+		time.Sleep(poolStatsInterval)
+		stats := h.Pool.Stats()
+		now := time.Now()
+		m.LogPool(&stats, &now)
+	}
+}
+
 func (h *Handler) handleError(bot *Bot, conn net.Conn, sleep time.Duration, err error) {
 
 	// StackTrace, we need to know where the error happened
@@ -354,13 +854,17 @@ func (h *Handler) handleError(bot *Bot, conn net.Conn, sleep time.Duration, err
 
 	// Remove Heartbeat Task
 	h.removeHeartbeat(bot)
+	bot.cancelHello()
+	bot.cancelReclaim()
+	bot.cancelRenewal()
 
 	// Remove File Descriptor from poller to avoid EOF error
 	if bot.status != DISCONNECTED {
 
 		h.botMutex.Lock()
-		delete(h.bots, conn)
-		_ = h.epoll.Remove(bot.fd)
+		if h.bots.Delete(bot.fd, bot) {
+			_ = h.poller.Remove(bot.polled.Swap(nil), bot.fd)
+		}
 		h.botMutex.Unlock()
 
 		bot.client.Disconnect()
@@ -372,23 +876,53 @@ func (h *Handler) handleError(bot *Bot, conn net.Conn, sleep time.Duration, err
 
 	bot.status = DISCONNECTED
 
-	if sleep == 0 {
-		sleep = 5 * time.Second
+	if bot.removed.Load() {
+		return
+	}
+	if bot.disabled.Load() {
+		h.forgetBot(bot)
+		return
+	}
+
+	// Only the probe reconnects while Steam is down
+	if h.outage.park(bot) {
+		h.log.Info().
+			Str("bot", bot.Name).
+			Msg("Parked until Steam is back up")
+		return
+	}
+
+	// sleep is the minimum, the backoff spreads the bots beyond it
+	if backoff := bot.backoff.Next(); backoff > sleep {
+		sleep = backoff
 	}
 
-	// Try reconnecting
-	h.timeTree.AddTask(&Task{
+	h.scheduleReconnect(bot, sleep)
+}
+
+func (h *Handler) scheduleReconnect(bot *Bot, delay time.Duration) {
+	h.scheduler.AddTask(&Task{
 		T: Function,
 		Value: func() {
 			h.connectBot(bot)
 		},
-		Time: time.Now().Add(sleep).UnixNano(),
+		Time: time.Now().Add(delay).UnixNano(),
 	})
 }
 
 // TODO: Make specific methods for each packet type
 func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet) {
 
+	// A malformed packet must not take down every other bot
+	defer h.Pool.Recover(func(v any, stack []byte) {
+		h.log.Error().
+			Str("bot", bot.Name).
+			Str("emsg", packet.EMsg.String()).
+			Interface("panic", v).
+			Str("stack", string(stack)).
+			Msg("Recovered panic handling packet")
+	})
+
 	c := bot.client
 
 	var err error
@@ -408,7 +942,7 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 				Str("bot", bot.Name).
 				Msg("Encryption Complete")
 
-			h.loginBot(bot)
+			h.logins.Admit(bot)
 		}
 
 	// Multiple Packets
@@ -420,7 +954,7 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 		}
 
 	// Auth
-	case steamlang.EMsg_ClientLogOnResponse: // TODO: Handle EResult
+	case steamlang.EMsg_ClientLogOnResponse:
 		var l *steam.LoggedOnEvent
 		l, err = c.Auth.HandleLogOnResponse(packet)
 		if err != nil {
@@ -429,29 +963,18 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 
 		if l.Result != steamlang.EResult_OK {
 
-			switch l.Result {
-			case steamlang.EResult_Expired:
-				h.tokenDB.SetToken(bot.Name, "")
-				fallthrough
-			case steamlang.EResult_TryAnotherCM:
-				h.handleError(bot, conn, 0, errors.New("login failed | "+steamlang.EResult_name[l.Result]))
-			default:
-				h.handleError(bot, conn, 60*time.Second, errors.New("login failed | "+steamlang.EResult_name[l.Result]))
+			if l.Result == steamlang.EResult_RateLimitExceeded {
+				h.logins.RateLimited(bot.getRegion())
 			}
+
+			h.handleLoginFailure(bot, conn, l.Result, errors.New("login failed | "+steamlang.EResult_name[l.Result]))
 			break
 		}
 
+		h.logins.Success(bot.getRegion())
+
 		// Add Heartbeat Task for this Bot
-		h.heartbeatInterval = l.InGameSecsPerHeartbeat
-		h.heartbeatMutex.Lock()
-		next := time.Now().Add(time.Duration(h.heartbeatInterval) * time.Second).UnixNano()
-		h.heartbeats[bot.Name] = next
-		h.timeTree.AddTask(&Task{
-			T:     Heartbeat,
-			Value: bot.index,
-			Time:  next,
-		})
-		h.heartbeatMutex.Unlock()
+		h.startHeartbeat(bot, time.Duration(l.InGameSecsPerHeartbeat)*time.Second)
 
 		// Logged In
 		bot.status = LOGGED_IN
@@ -463,15 +986,20 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 		if bot.client.Auth.Details != nil {
 			h.log.Debug().
 				Str("bot", bot.Name).
-				Str("refresh_token", bot.client.Auth.Details.RefreshToken).
 				Msg("Got Refresh Token")
 
-			h.tokenDB.SetToken(bot.Name, bot.client.Auth.Details.RefreshToken)
+			if err := h.tokenDB.SetToken(bot.Name, bot.client.Auth.Details.RefreshToken); err != nil {
+				h.log.Err(err).
+					Str("bot", bot.Name).
+					Msg("Error saving refresh token")
+			}
+			h.trackToken(bot, bot.client.Auth.Details.RefreshToken)
 
 			// Wipe Memory
 			bot.client.Auth.Details = nil
 			bot.client.Auth.Authenticator = nil
 		}
+		h.scheduleTokenRenewal(bot, 0)
 
 		// Request Free License
 		h.log.Info().
@@ -495,16 +1023,44 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 
 		// Remove Heartbeat Task
 		h.removeHeartbeat(bot)
+		bot.cancelHello()
+		bot.cancelReclaim()
+		bot.status = CONNECTED
+
+		if h.loginPolicy(msg.Result).Action == LoginDisable {
+			h.disableBot(bot, conn, errors.New("logged off | "+steamlang.EResult_name[msg.Result]))
+			break
+		}
+
+		// Steam itself logged us off, which counts towards an outage and parks the bot if Steam is down
+		if steamSide(msg.Result) {
+			h.handleLoginFailure(bot, conn, msg.Result, errors.New("logged off | "+steamlang.EResult_name[msg.Result]))
+			break
+		}
+
+		// Try login after MinReconnect, the backoff spreads bots logged off at once
+		delay := time.Duration(msg.MinReconnect+1) * time.Second
+		if backoff := bot.backoff.Next(); backoff > delay {
+			delay = backoff
+		}
 
-		// Try login after MinReconnect
-		h.timeTree.AddTask(&Task{
+		// Somebody else logged in with the account
+		if msg.Result == steamlang.EResult_LoggedInElsewhere {
+			if yield := h.sessionConflict(bot, ConflictLoggedIn); yield > delay {
+				delay = yield
+			}
+		}
+
+		h.scheduler.AddTask(&Task{
 			T: Function,
 			Value: func() {
-				h.loginBot(bot)
+				h.logins.Admit(bot)
 			},
-			Time: time.Now().Add(time.Duration(msg.MinReconnect+1) * time.Second).UnixNano(),
+			Time: time.Now().Add(delay).UnixNano(),
 		})
 
+	case steamlang.EMsg_ClientPlayingSessionState:
+		h.handlePlayingSessionState(bot, packet)
 	case steamlang.EMsg_ClientUpdateMachineAuth:
 		c.Auth.HandleUpdateMachineAuth(packet)
 	case steamlang.EMsg_ClientAccountInfo:
@@ -525,16 +1081,13 @@ func (h *Handler) handlePacket(bot *Bot, conn net.Conn, packet *protocol.Packet)
 		err = bot.client.GC.SetGamesPlayed(730)
 	case steamlang.EMsg_ClientGameConnectTokens:
 
-		h.log.Info().
-			Str("bot", bot.Name).
-			Msg("Send Hello")
-
-		err = bot.client.GC.Write(gamecoordinator.NewGCMsgProtobuf(730,
-			uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientHello),
-			&cs2.CMsgClientHello{
-				Version: proto.Uint32(2000244),
-			},
-		))
+		// Logged in again while yielding, like after a reconnect
+		if bot.yielding() {
+			_, _, until := bot.getConflict()
+			h.scheduleReclaim(bot, until)
+		} else if err = h.sendHello(bot); err == nil {
+			h.scheduleHello(bot, 0)
+		}
 
 	// GC
 	case steamlang.EMsg_ClientFromGC:
@@ -571,11 +1124,49 @@ func (h *Handler) handleGCPacket(bot *Bot, packet *gamecoordinator.GCPacket) {
 		switch packet.MsgType {
 		case uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientWelcome):
 
+			var msg cs2.CMsgClientWelcome
+			if err := proto.Unmarshal(packet.Body, &msg); err != nil {
+				h.log.Err(err).
+					Str("bot", bot.Name).
+					Msg("Error Unmarshalling ClientWelcome")
+			}
+
 			h.log.Info().
 				Str("bot", bot.Name).
+				Uint32("version", msg.GetVersion()).
 				Msg("ClientWelcome")
 
 			bot.status = INGAME
+			bot.backoff.Reset()
+			bot.helloBackoff.Reset()
+			bot.setGCQueue(0, 0)
+			bot.cancelHello()
+			bot.cancelReclaim()
+			bot.clearConflict()
+
+			// Only the first welcome after connecting
+			if !bot.connectedAt.IsZero() {
+				h.logIngame(bot, time.Since(bot.connectedAt))
+				bot.connectedAt = time.Time{}
+			}
+			h.steamSuccess(bot)
+
+			// Re-hello the other bots after the state of this one is updated
+			h.SetGCVersion(msg.GetVersion())
+
+		case uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientConnectionStatus):
+			h.handleGCConnectionStatus(bot, packet)
+
+		case uint32(cs2.EGCItemMsg_k_EMsgGCClientVersionUpdated):
+
+			var msg cs2.CMsgGCClientVersionUpdated
+			if err := proto.Unmarshal(packet.Body, &msg); err != nil {
+				h.log.Err(err).
+					Str("bot", bot.Name).
+					Msg("Error Unmarshalling Client Version Update")
+				break
+			}
+			h.SetGCVersion(msg.GetClientVersion())
 
 		case uint32(cs2.ECsgoGCMsg_k_EMsgGCCStrike15_v2_Client2GCEconPreviewDataBlockResponse):
 			h.handleInspectResponse(bot, packet)
@@ -589,43 +1180,272 @@ func (h *Handler) handleGCPacket(bot *Bot, packet *gamecoordinator.GCPacket) {
 	}
 }
 
-func (h *Handler) removeHeartbeat(bot *Bot) {
-	var ok bool
-	for range 3 {
-		h.heartbeatMutex.Lock()
-		nextHearteat := h.heartbeats[bot.Name]
-		if nextHearteat == 0 {
-			h.heartbeatMutex.Unlock()
-			ok = true
-			break
-		}
-		h.timeTree.RemoveTask(nextHearteat)
-		delete(h.heartbeats, bot.Name)
-		h.heartbeatMutex.Unlock()
+// sendHello asks the GC for a session, it answers with ClientWelcome
+func (h *Handler) sendHello(bot *Bot) error {
+
+	// The other session keeps the GC until the yield ends
+	if bot.yielding() {
+		return nil
 	}
-	if !ok {
-		h.log.Warn().
+
+	bot.gcMutex.Lock()
+	bot.helloAttempts++
+	attempt := bot.helloAttempts
+	bot.gcMutex.Unlock()
+
+	h.log.Info().
+		Str("bot", bot.Name).
+		Int("attempt", attempt).
+		Msg("Send Hello")
+
+	return bot.client.GC.Write(gamecoordinator.NewGCMsgProtobuf(730,
+		uint32(cs2.EGCBaseClientMsg_k_EMsgGCClientHello),
+		&cs2.CMsgClientHello{
+			Version: proto.Uint32(h.GCVersion()),
+		},
+	))
+}
+
+// scheduleHello is the watchdog of the welcome, it sends another hello after the backoff, but not before wait.
+// Once helloRetries hellos went unanswered, the bot reconnects.
+func (h *Handler) scheduleHello(bot *Bot, wait time.Duration) {
+
+	if bot.yielding() {
+		return
+	}
+
+	delay := bot.helloBackoff.Next()
+	if wait > delay {
+		delay = wait
+	}
+
+	task := &Task{
+		T: Function,
+		Value: func() {
+			// Only while logged in without GC session
+			if bot.status != LOGGED_IN && bot.status != GC_WAITING || bot.removed.Load() {
+				return
+			}
+
+			bot.gcMutex.Lock()
+			attempts := bot.helloAttempts
+			bot.gcMutex.Unlock()
+
+			if attempts >= h.helloRetries {
+				h.handleError(bot, bot.conn, 0, fmt.Errorf("no GC welcome after %d hellos", attempts))
+				return
+			}
+
+			if err := h.sendHello(bot); err != nil {
+				h.handleError(bot, bot.conn, 0, err)
+				return
+			}
+			h.scheduleHello(bot, 0)
+		},
+		Time: time.Now().Add(delay).UnixNano(),
+	}
+
+	bot.gcMutex.Lock()
+	if bot.hello != nil {
+		bot.hello.Cancel()
+	}
+	bot.hello = h.scheduler.AddTask(task)
+	bot.gcMutex.Unlock()
+}
+
+// handleGCConnectionStatus handles the GC dropping the session of the bot or queueing it.
+// There is no separate goodbye message, the GC sends the status when it goes down as well.
+func (h *Handler) handleGCConnectionStatus(bot *Bot, packet *gamecoordinator.GCPacket) {
+
+	var msg cs2.CMsgConnectionStatus
+	if err := proto.Unmarshal(packet.Body, &msg); err != nil {
+		h.log.Err(err).
 			Str("bot", bot.Name).
-			Msg("Failed to remove Heartbeat Task 2nd try")
+			Msg("Error Unmarshalling GC Connection Status")
+		return
+	}
+
+	status := msg.GetStatus()
+	bot.setGCQueue(msg.GetQueuePosition(), msg.GetQueueSize())
+
+	// The GC answers, so don't count the hellos so far against the watchdog
+	bot.gcMutex.Lock()
+	bot.helloAttempts = 0
+	bot.gcMutex.Unlock()
+
+	h.log.Info().
+		Str("bot", bot.Name).
+		Str("status", status.String()).
+		Int32("queue_position", msg.GetQueuePosition()).
+		Int32("queue_size", msg.GetQueueSize()).
+		Int32("wait", msg.GetWaitSeconds()).
+		Msg("GC Connection Status")
+
+	if status == cs2.GCConnectionStatus_GCConnectionStatus_HAVE_SESSION {
+		return
+	}
+
+	// No inspects until the GC welcomes us again
+	if bot.status == INGAME || bot.status == LOGGED_IN {
+		bot.status = GC_WAITING
+	}
+	h.steamFailure(bot, errors.New("GC connection status | "+status.String()))
+
+	h.scheduleHello(bot, time.Duration(msg.GetWaitSeconds())*time.Second)
+}
+
+const defaultHeartbeatInterval = 9 * time.Second // Just in case steam returns 0
+
+type heartbeat struct {
+	bot      *Bot
+	interval time.Duration
+	task     *Task
+	handle   TaskHandle
+}
+
+// startHeartbeat schedules the heartbeats of a logged in bot, replacing the ones of a previous session
+func (h *Handler) startHeartbeat(bot *Bot, interval time.Duration) {
+
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	task := &Task{
+		T:     Heartbeat,
+		Value: bot.id,
+		Time:  time.Now().Add(interval).UnixNano(),
+	}
+
+	h.heartbeatMutex.Lock()
+	if hb := h.heartbeats[bot.id]; hb != nil {
+		hb.handle.Cancel()
+	}
+	h.heartbeats[bot.id] = &heartbeat{
+		bot:      bot,
+		interval: interval,
+		task:     task,
+		handle:   h.scheduler.AddTask(task),
+	}
+	h.heartbeatMutex.Unlock()
+}
+
+func (h *Handler) removeHeartbeat(bot *Bot) {
+	h.heartbeatMutex.Lock()
+	if hb := h.heartbeats[bot.id]; hb != nil {
+		hb.handle.Cancel()
+		delete(h.heartbeats, bot.id)
 	}
+	h.heartbeatMutex.Unlock()
 }
 
+// GetLoginsWaiting returns the amount of bots waiting for their turn to log in
+func (h *Handler) GetLoginsWaiting() int {
+	return h.logins.Waiting()
+}
+
+// BotInfo is the detailed status of a bot
+type BotInfo struct {
+	ID       uint64
+	Name     string
+	Status   BotStatus
+	Disabled bool
+	Reason   string // Why the bot got disabled
+	Region   string // Proxy session or local address
+	CM       string
+	Failures int // Consecutive failed connects or logins
+
+	// Position in the logon queue of the GC, while waiting for a session
+	GCQueuePosition int32
+	GCQueueSize     int32
+
+	// Use of the account elsewhere, e.g. somebody playing on it manually
+	Conflict      string    // Current conflict, empty if none
+	ConflictAt    time.Time // Last conflict, zero if there never was one
+	ConflictUntil time.Time // End of yielding the session to the other client
+
+	TokenExpiry time.Time // Expiry of the refresh token, zero if unknown
+}
+
+// GetBotInfos returns the detailed status of all bots
+func (h *Handler) GetBotInfos() []BotInfo {
+	h.botMutex.RLock()
+	defer h.botMutex.RUnlock()
+
+	infos := make([]BotInfo, 0, len(h.botQueue))
+	for _, bot := range h.botQueue {
+
+		info := BotInfo{
+			ID:       bot.id,
+			Name:     bot.Name,
+			Status:   bot.status,
+			Region:   bot.getRegion(),
+			CM:       bot.getCM(),
+			Failures: bot.backoff.Attempts(),
+		}
+		info.GCQueuePosition, info.GCQueueSize = bot.gcQueue()
+		info.Conflict, info.ConflictAt, info.ConflictUntil = bot.getConflict()
+		if expiry := bot.tokenExpiry.Load(); expiry != 0 {
+			info.TokenExpiry = time.Unix(expiry, 0)
+		}
+		if bot.disabled.Load() {
+			info.Disabled = true
+			info.Reason = bot.disabledReason
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// GetBotStatus returns the amount of bots per BotStatus, the total at index 4
+// GC_WAITING is counted as LOGGED_IN, see GetBotCounts for it and the disabled ones
 func (h *Handler) GetBotStatus() (status [5]int) {
 	h.botMutex.RLock()
 	status[4] = len(h.botQueue)
 	for _, bot := range h.botQueue {
-		if bot != nil {
-			status[bot.status]++
+		if bot.status == GC_WAITING {
+			status[LOGGED_IN]++
+			continue
 		}
+		status[bot.status]++
 	}
 	h.botMutex.RUnlock()
 
 	return
 }
 
-func initializeSteamDirectory(log *zerolog.Logger) {
-	err := steam.InitializeSteamDirectory()
-	if err != nil {
-		log.Err(err).Msg("Error initializing Steam directory")
+// BotCounts is the amount of bots per BotStatus
+type BotCounts struct {
+	Disconnected int
+	Connected    int
+	LoggedIn     int
+	Ingame       int
+	GCWaiting    int
+	Disabled     int // Counted as Disconnected as well
+	Total        int
+}
+
+// GetBotCounts returns the amount of bots per BotStatus, including the disabled ones
+func (h *Handler) GetBotCounts() (counts BotCounts) {
+	h.botMutex.RLock()
+	defer h.botMutex.RUnlock()
+
+	counts.Total = len(h.botQueue)
+	for _, bot := range h.botQueue {
+		switch bot.status {
+		case DISCONNECTED:
+			counts.Disconnected++
+		case CONNECTED:
+			counts.Connected++
+		case LOGGED_IN:
+			counts.LoggedIn++
+		case INGAME:
+			counts.Ingame++
+		case GC_WAITING:
+			counts.GCWaiting++
+		}
+		if bot.disabled.Load() {
+			counts.Disabled++
+		}
 	}
+	return
 }
@@ -0,0 +1,142 @@
+package inspect
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xAozora/cs2-inspect/types"
+)
+
+func TestBotQueueRemoval(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+	a, _ := newHeartbeatBot(h, "a")
+	b, _ := newHeartbeatBot(h, "b")
+	c, _ := newHeartbeatBot(h, "c")
+
+	if err := h.RemoveBot(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue is compacted, the other bots keep their slots
+	if len(h.botQueue) != 2 || h.botQueue[a.index] != a || h.botQueue[c.index] != c {
+		t.Fatalf("queue not compacted, got %v", h.botQueue)
+	}
+	if a.slot != 0 || c.slot != 2 {
+		t.Fatalf("slots changed to %d and %d", a.slot, c.slot)
+	}
+	if status := h.GetBotStatus(); status[4] != 2 || status[LOGGED_IN] != 2 {
+		t.Fatalf("removed bot counted, got %v", status)
+	}
+	if infos := h.GetBotInfos(); len(infos) != 2 {
+		t.Fatalf("expected 2 infos, got %d", len(infos))
+	}
+
+	// The next bot takes over the proxy of the removed one, the one after gets a new slot
+	d, _ := newHeartbeatBot(h, "d")
+	e, _ := newHeartbeatBot(h, "e")
+	if d.slot != 1 || e.slot != 3 {
+		t.Fatalf("expected slots 1 and 3, got %d and %d", d.slot, e.slot)
+	}
+}
+
+func TestInspectWithoutBots(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+
+	request := types.Request{L: []*types.Info{{A: 1}}}
+	if n, _ := h.Inspect(&request, request.L); n != 1 {
+		t.Fatalf("expected 1 item queued, got %d", n)
+	}
+
+	// The inspect loop gives up on the item instead of picking from an empty queue
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint32(&h.len) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("item not released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAddBotAgain(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+	bot, _ := newHeartbeatBot(h, "bot")
+
+	if err := h.AddBot(bot); err == nil {
+		t.Fatal("bot added twice")
+	}
+
+	// Disabled bots have to be replaced after fixing their account, not added again
+	bot.disabled.Store(true)
+	bot.status = DISCONNECTED
+	if counts := h.GetBotCounts(); counts.Disabled != 1 || counts.Disconnected != 1 || counts.Total != 1 {
+		t.Fatalf("unexpected counts %+v", counts)
+	}
+
+	if err := h.RemoveBot(bot); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddBot(bot); err == nil {
+		t.Fatal("removed bot added again")
+	}
+	if status := h.GetBotStatus(); status[4] != 0 {
+		t.Fatalf("removed bot still counted, got %v", status)
+	}
+}
+
+func TestConnectFailure(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	bot, _ := newHeartbeatBot(h, "bot")
+	bot.status = DISCONNECTED
+	cms := NewCMSelector([]string{"invalid"})
+	bot.cms = cms
+
+	// A single attempt, the retry goes through the scheduler instead of blocking the worker
+	start := time.Now()
+	h.connectBot(bot)
+	if time.Since(start) > time.Second {
+		t.Fatal("connect blocked")
+	}
+	if len(s.tasks) != 1 || time.Unix(0, s.tasks[0].task.Time).Before(start) {
+		t.Fatalf("expected a reconnect, got %d tasks", len(s.tasks))
+	}
+	if bot.status != DISCONNECTED {
+		t.Fatalf("expected DISCONNECTED, got %s", bot.status)
+	}
+	if cms.regions[""]["invalid"].blacklisted == 0 {
+		t.Fatal("CM not marked failed")
+	}
+}
+
+// Run with -race, GetBotInfos reads the CM and region while the bot connects
+func TestBotInfosWhileConnecting(t *testing.T) {
+
+	addrs, err := NewLocalAddrList("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := newTestHandler(t, &Config{LocalAddrList: addrs})
+	bot, _ := newHeartbeatBot(h, "bot")
+	bot.status = DISCONNECTED
+	bot.cms = NewCMSelector([]string{"invalid"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			h.GetBotInfos()
+		}
+	}()
+	for range 10 {
+		h.connectBot(bot)
+	}
+	<-done
+
+	if info := h.GetBotInfos()[0]; info.CM != "invalid" || info.Region != "127.0.0.1" {
+		t.Fatalf("unexpected CM %q and region %q", info.CM, info.Region)
+	}
+}
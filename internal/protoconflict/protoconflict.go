@@ -0,0 +1,13 @@
+// Package protoconflict allows tests of the inspect package to run.
+// The CS2 protobufs and the ones of go-steam share file names, which makes the protobuf registry panic at init.
+// Packages initialize in import path order, so this runs before go-steam registers its protobufs.
+// Binaries need to set GOLANG_PROTOBUF_REGISTRATION_CONFLICT themselves.
+package protoconflict
+
+import "os"
+
+func init() {
+	if os.Getenv("GOLANG_PROTOBUF_REGISTRATION_CONFLICT") == "" {
+		_ = os.Setenv("GOLANG_PROTOBUF_REGISTRATION_CONFLICT", "ignore")
+	}
+}
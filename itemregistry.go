@@ -0,0 +1,75 @@
+package inspect
+
+import "sync"
+
+const itemShards = 64 // Power of two
+
+// itemRegistry maps the asset IDs of items in flight to their InspectTask.
+// It is split into shards with their own lock, so the inspect loop,
+// responses handled in the pool and timeouts don't contend on a single mutex.
+type itemRegistry struct {
+	shards [itemShards]itemShard
+}
+
+type itemShard struct {
+	items map[uint64]inflightItem
+	mutex sync.Mutex
+	_     [48]byte // Keep shards on separate cache lines
+}
+
+type inflightItem struct {
+	task    *InspectTask
+	timeout TaskHandle
+}
+
+func newItemRegistry() *itemRegistry {
+	r := &itemRegistry{}
+	for i := range r.shards {
+		r.shards[i].items = make(map[uint64]inflightItem)
+	}
+	return r
+}
+
+// Asset IDs are mostly sequential, so they get spread by a multiplicative hash
+func (r *itemRegistry) shard(id uint64) *itemShard {
+	return &r.shards[(id*0x9E3779B97F4A7C15)>>58&(itemShards-1)]
+}
+
+// Add registers the item with its timeout, false if it is already in flight
+func (r *itemRegistry) Add(id uint64, task *InspectTask, timeout TaskHandle) bool {
+	s := r.shard(id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.items[id]; ok {
+		return false
+	}
+	s.items[id] = inflightItem{task, timeout}
+	return true
+}
+
+// Remove unregisters the item and returns its InspectTask and timeout, nil if it wasn't in flight.
+// Only one of the response and the timeout gets the task this way.
+func (r *itemRegistry) Remove(id uint64) (*InspectTask, TaskHandle) {
+	s := r.shard(id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[id]
+	if ok {
+		delete(s.items, id)
+	}
+	return item.task, item.timeout
+}
+
+// Len returns the amount of items in flight
+func (r *itemRegistry) Len() int {
+	var n int
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mutex.Lock()
+		n += len(s.items)
+		s.mutex.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package inspect
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+)
+
+func TestItemRegistry(t *testing.T) {
+
+	r := newItemRegistry()
+	a, b := &InspectTask{}, &InspectTask{}
+
+	if !r.Add(1, a, nil) || !r.Add(2, a, nil) {
+		t.Fatal("item not added")
+	}
+	if r.Add(1, b, nil) {
+		t.Fatal("item added twice")
+	}
+	if r.Len() != 2 {
+		t.Fatalf("expected 2 items, got %d", r.Len())
+	}
+
+	// Either the response or the timeout gets the task
+	if task, _ := r.Remove(1); task != a {
+		t.Fatal("item not removed")
+	}
+	if task, _ := r.Remove(1); task != nil {
+		t.Fatal("item removed twice")
+	}
+	if task, _ := r.Remove(3); task != nil {
+		t.Fatal("unknown item removed")
+	}
+}
+
+// BenchmarkItemRegistry registers items and removes them again from parallel goroutines,
+// like the inspect loop and responses handled in the pool
+func BenchmarkItemRegistry(b *testing.B) {
+
+	b.Run("mutex", func(b *testing.B) {
+		var mutex sync.Mutex
+		items := make(map[uint64]*InspectTask)
+		benchmarkItemRegistry(b, func(id uint64, task *InspectTask) {
+			mutex.Lock()
+			items[id] = task
+			mutex.Unlock()
+		}, func(id uint64) *InspectTask {
+			mutex.Lock()
+			task := items[id]
+			delete(items, id)
+			mutex.Unlock()
+			return task
+		})
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		r := newItemRegistry()
+		benchmarkItemRegistry(b, func(id uint64, task *InspectTask) {
+			r.Add(id, task, nil)
+		}, func(id uint64) *InspectTask {
+			task, _ := r.Remove(id)
+			return task
+		})
+	})
+}
+
+func benchmarkItemRegistry(b *testing.B, add func(uint64, *InspectTask), remove func(uint64) *InspectTask) {
+
+	const inFlight = 64 // Items each goroutine keeps in flight
+	task := &InspectTask{}
+
+	// Asset IDs are mostly sequential
+	var next atomic.Uint64
+	next.Store(30000000000)
+
+	b.RunParallel(func(pb *testing.PB) {
+		var ring [inFlight]uint64
+		var i int
+		for pb.Next() {
+			if id := ring[i]; id != 0 && remove(id) == nil {
+				b.Error("item lost")
+				return
+			}
+			ring[i] = next.Add(1)
+			add(ring[i], task)
+			i = (i + 1) % inFlight
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package inspect
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// LocalAddrList assigns each bot a local source address to bind its connection to.
+// Entries are either single addresses or CIDR ranges, ranges are expanded on demand.
+// Like the ProxyList, a bot is mapped by its slot, so it keeps the same address across reconnects.
+// Bots past the end of the list get no address.
+// Keep in mind the address family has to match the one of the CM.
+type LocalAddrList struct {
+	Addresses []string
+
+	prefixes []netip.Prefix
+	zones    []string // IPv6 zone of single addresses
+	offsets  []uint64 // Offset of the first usable address
+	sizes    []int
+	total    int
+}
+
+// NewLocalAddrList parses the given addresses and CIDR ranges
+func NewLocalAddrList(addresses ...string) (*LocalAddrList, error) {
+
+	if len(addresses) == 0 {
+		return nil, errors.New("no local addresses")
+	}
+
+	l := &LocalAddrList{
+		Addresses: addresses,
+		prefixes:  make([]netip.Prefix, 0, len(addresses)),
+		zones:     make([]string, 0, len(addresses)),
+		offsets:   make([]uint64, 0, len(addresses)),
+		sizes:     make([]int, 0, len(addresses)),
+	}
+
+	for _, address := range addresses {
+
+		var prefix netip.Prefix
+		var zone string
+		if strings.Contains(address, "/") {
+			p, err := netip.ParsePrefix(address)
+			if err != nil {
+				return nil, err
+			}
+			prefix = p.Masked()
+		} else {
+			addr, err := netip.ParseAddr(address)
+			if err != nil {
+				return nil, err
+			}
+			// Prefixes can't hold zones, so it is kept aside
+			zone = addr.Zone()
+			prefix = netip.PrefixFrom(addr.WithZone(""), addr.BitLen())
+		}
+
+		var offset uint64
+		size := math.MaxInt
+		if bits := prefix.Addr().BitLen() - prefix.Bits(); bits < 62 {
+			size = 1 << bits
+		}
+
+		// Skip the network and broadcast address of IPv4 subnets, /31 and /32 have none
+		if prefix.Addr().Is4() && prefix.Bits() < 31 {
+			offset = 1
+			size -= 2
+		}
+
+		l.prefixes = append(l.prefixes, prefix)
+		l.zones = append(l.zones, zone)
+		l.offsets = append(l.offsets, offset)
+		l.sizes = append(l.sizes, size)
+
+		if l.total > math.MaxInt-size {
+			l.total = math.MaxInt
+		} else {
+			l.total += size
+		}
+	}
+
+	return l, nil
+}
+
+// Get returns the address for the given bot slot, nil once the list is exhausted
+func (l *LocalAddrList) Get(slot int) *net.TCPAddr {
+
+	if slot < 0 || slot >= l.total {
+		return nil
+	}
+
+	for i, prefix := range l.prefixes {
+		if slot >= l.sizes[i] {
+			slot -= l.sizes[i]
+			continue
+		}
+
+		addr := addOffset(prefix.Addr(), l.offsets[i]+uint64(slot))
+		return &net.TCPAddr{IP: net.IP(addr.AsSlice()), Zone: l.zones[i]}
+	}
+
+	return nil
+}
+
+// addOffset adds n to the address, the caller has to make sure it stays within its prefix
+func addOffset(addr netip.Addr, n uint64) netip.Addr {
+
+	b := addr.As16()
+	for i := 15; i >= 0 && n != 0; i-- {
+		sum := uint64(b[i]) + n&0xff
+		b[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+
+	next := netip.AddrFrom16(b)
+	if addr.Is4() {
+		return next.Unmap()
+	}
+	return next
+}
@@ -0,0 +1,54 @@
+package inspect
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestAddOffset(t *testing.T) {
+
+	for _, c := range []struct {
+		addr string
+		n    uint64
+		want string
+	}{
+		{"10.0.0.1", 0, "10.0.0.1"},
+		{"10.0.0.255", 1, "10.0.1.0"},
+		{"10.0.255.255", 1, "10.1.0.0"},
+		{"10.0.0.0", 65536 + 258, "10.1.1.2"},
+		{"2001:db8::ffff", 1, "2001:db8::1:0"},
+		{"2001:db8::", 1 << 40, "2001:db8::100:0:0"},
+	} {
+		got := addOffset(netip.MustParseAddr(c.addr), c.n)
+		if got.String() != c.want {
+			t.Fatalf("%s + %d: expected %s, got %s", c.addr, c.n, c.want, got)
+		}
+	}
+}
+
+func TestLocalAddrList(t *testing.T) {
+
+	l, err := NewLocalAddrList("192.0.2.0/30", "198.51.100.7", "198.51.100.8/31", "fe80::1%eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Network and broadcast addresses are skipped, /31 has none
+	want := []string{"192.0.2.1", "192.0.2.2", "198.51.100.7", "198.51.100.8", "198.51.100.9", "fe80::1%eth0"}
+	for i, w := range want {
+		if got := l.Get(i); got == nil || got.String() != w+":0" && got.String() != "["+w+"]:0" {
+			t.Fatalf("index %d: expected %s, got %v", i, w, got)
+		}
+	}
+
+	if l.Get(-1) != nil {
+		t.Fatal("address for a negative index")
+	}
+	if l.Get(len(want)) != nil {
+		t.Fatal("address shared past the end of the list")
+	}
+
+	if _, err = NewLocalAddrList("192.0.2.0/33"); err == nil {
+		t.Fatal("invalid prefix accepted")
+	}
+}
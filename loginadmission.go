@@ -0,0 +1,202 @@
+package inspect
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoginInterval       = 50 * time.Millisecond
+	defaultRegionLoginInterval = 2 * time.Second
+	loginRateLimitBase         = time.Minute // Pause of a region after RateLimitExceeded, doubled for each consecutive one
+	loginRateLimitMax          = 30 * time.Minute
+)
+
+// loginAdmission queues logins and spaces them out, globally and per region (proxy session or local address).
+// Steam answers too many logins from one IP with RateLimitExceeded, so a rate limited region pauses.
+// Regions take turns, so a single busy proxy doesn't hold up the others.
+type loginAdmission struct {
+	scheduler Scheduler
+	login     func(*Bot)
+
+	interval       time.Duration // Between any two logins
+	regionInterval time.Duration // Between two logins of the same region
+
+	regions map[string]*loginRegion
+	ring    []*loginRegion // Regions with waiting bots, in turn
+	turn    int
+	waiting int
+	next    int64      // Earliest next login, unix nano
+	tick    TaskHandle // Scheduled dispatch, nil if idle
+	tickAt  int64      // Time of the scheduled dispatch, unix nano
+	mutex   sync.Mutex
+}
+
+type loginRegion struct {
+	name        string
+	bots        []*Bot
+	next        int64 // Earliest next login of this region, unix nano
+	rateLimited int   // Consecutive RateLimitExceeded
+}
+
+func newLoginAdmission(scheduler Scheduler, login func(*Bot), interval, regionInterval time.Duration) *loginAdmission {
+
+	if interval <= 0 {
+		interval = defaultLoginInterval
+	}
+	if regionInterval <= 0 {
+		regionInterval = defaultRegionLoginInterval
+	}
+
+	return &loginAdmission{
+		scheduler:      scheduler,
+		login:          login,
+		interval:       interval,
+		regionInterval: regionInterval,
+		regions:        make(map[string]*loginRegion),
+	}
+}
+
+// Admit queues the bot for login
+func (a *loginAdmission) Admit(bot *Bot) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	region := bot.getRegion()
+	r := a.regions[region]
+	if r == nil {
+		r = &loginRegion{name: region}
+		a.regions[region] = r
+	}
+
+	for _, b := range r.bots {
+		if b == bot {
+			return
+		}
+	}
+
+	if len(r.bots) == 0 {
+		a.ring = append(a.ring, r)
+	}
+	r.bots = append(r.bots, bot)
+	a.waiting++
+
+	a.schedule(time.Now().UnixNano())
+}
+
+// RateLimited pauses the region after Steam answered a login with RateLimitExceeded
+func (a *loginAdmission) RateLimited(region string) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	r := a.regions[region]
+	if r == nil {
+		r = &loginRegion{name: region}
+		a.regions[region] = r
+	}
+
+	d := loginRateLimitBase << min(r.rateLimited, 16)
+	if d > loginRateLimitMax {
+		d = loginRateLimitMax
+	}
+	r.rateLimited++
+	r.next = max(r.next, time.Now().Add(d).UnixNano())
+}
+
+// Success resets the rate limit backoff of the region
+func (a *loginAdmission) Success(region string) {
+	a.mutex.Lock()
+	if r := a.regions[region]; r != nil {
+		r.rateLimited = 0
+	}
+	a.mutex.Unlock()
+}
+
+// Waiting returns the amount of bots waiting to log in
+func (a *loginAdmission) Waiting() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.waiting
+}
+
+// dispatch logs in the next bot whose region is ready
+func (a *loginAdmission) dispatch() {
+
+	now := time.Now().UnixNano()
+
+	a.mutex.Lock()
+	a.tick = nil
+
+	var bot *Bot
+	if now >= a.next {
+		for range len(a.ring) {
+			if len(a.ring) == 0 {
+				break
+			}
+			a.turn %= len(a.ring)
+			r := a.ring[a.turn]
+			if r.next > now {
+				a.turn++
+				continue
+			}
+
+			bot = r.bots[0]
+			r.bots[0] = nil
+			r.bots = r.bots[1:]
+			a.waiting--
+
+			if len(r.bots) == 0 {
+				a.ring = append(a.ring[:a.turn], a.ring[a.turn+1:]...)
+			} else {
+				a.turn++
+			}
+
+			// Bots which disconnected meanwhile get queued again once they are connected
+			if bot.status == DISCONNECTED || bot.removed.Load() {
+				bot = nil
+				continue
+			}
+
+			r.next = now + int64(a.regionInterval)
+			a.next = now + int64(a.interval)
+			break
+		}
+	}
+
+	a.schedule(now)
+	a.mutex.Unlock()
+
+	if bot != nil {
+		a.login(bot)
+	}
+}
+
+// schedule the next dispatch, if there are bots waiting.
+// A dispatch already scheduled is moved up if a region got ready earlier, e.g. while the others are paused.
+func (a *loginAdmission) schedule(now int64) {
+
+	if len(a.ring) == 0 {
+		return
+	}
+
+	at := a.ring[0].next
+	for _, r := range a.ring[1:] {
+		at = min(at, r.next)
+	}
+	at = max(at, a.next, now)
+
+	if a.tick != nil {
+		if a.tickAt <= at || !a.tick.Cancel() {
+			return
+		}
+	}
+
+	a.tickAt = at
+	a.tick = a.scheduler.AddTask(&Task{
+		T:     Function,
+		Value: a.dispatch,
+		Time:  at,
+	})
+}
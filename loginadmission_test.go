@@ -0,0 +1,130 @@
+package inspect
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func newAdmissionBot(name, region string) *Bot {
+	logger := zerolog.Nop()
+	bot := NewBot(Credentials{Name: name}, &logger)
+	bot.region.Store(&region)
+	bot.status = CONNECTED
+	return bot
+}
+
+// runAdmission runs the scheduled dispatch and returns when it is scheduled next
+func runAdmission(t *testing.T, s *manualScheduler) time.Time {
+	t.Helper()
+	if len(s.tasks) != 1 {
+		t.Fatalf("expected one dispatch, got %d", len(s.tasks))
+	}
+	s.take(s.tasks[0].task).Value.(func())()
+	if len(s.tasks) == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, s.tasks[0].task.Time)
+}
+
+func TestLoginAdmission(t *testing.T) {
+
+	s := &manualScheduler{}
+	var logins []string
+	a := newLoginAdmission(s, func(bot *Bot) { logins = append(logins, bot.Name) }, 20*time.Millisecond, time.Hour)
+
+	a.Admit(newAdmissionBot("a1", "a"))
+	a1 := a.regions["a"].bots[0]
+	a.Admit(a1) // Queued once
+	a.Admit(newAdmissionBot("a2", "a"))
+	a.Admit(newAdmissionBot("b1", "b"))
+	if a.Waiting() != 3 {
+		t.Fatalf("expected 3 waiting, got %d", a.Waiting())
+	}
+
+	// Spaced out globally
+	next := runAdmission(t, s)
+	if d := time.Until(next); d < 10*time.Millisecond || d > 20*time.Millisecond {
+		t.Fatalf("next login not spaced by the interval, in %s", d)
+	}
+
+	// Too early, nobody logs in
+	runAdmission(t, s)
+	if len(logins) != 1 {
+		t.Fatalf("login before the interval, got %v", logins)
+	}
+
+	// Regions take turns, a2 waits for the region interval
+	time.Sleep(time.Until(next))
+	next = runAdmission(t, s)
+	if strings.Join(logins, ",") != "a1,b1" {
+		t.Fatalf("unexpected order %v", logins)
+	}
+	if d := time.Until(next); d < 59*time.Minute {
+		t.Fatalf("region not spaced by its interval, next in %s", d)
+	}
+	if a.Waiting() != 1 {
+		t.Fatalf("expected 1 waiting, got %d", a.Waiting())
+	}
+}
+
+func TestLoginAdmissionRateLimited(t *testing.T) {
+
+	s := &manualScheduler{}
+	var logins []string
+	a := newLoginAdmission(s, func(bot *Bot) { logins = append(logins, bot.Name) }, time.Millisecond, time.Millisecond)
+
+	// Paused, doubling with every consecutive rate limit
+	a.RateLimited("a")
+	a.Admit(newAdmissionBot("a1", "a"))
+	if d := time.Until(time.Unix(0, s.tasks[0].task.Time)); d < 59*time.Second {
+		t.Fatalf("rate limited region not paused, next in %s", d)
+	}
+	a.RateLimited("a")
+	if d := time.Until(time.Unix(0, a.regions["a"].next)); d < 119*time.Second {
+		t.Fatalf("pause not doubled, next in %s", d)
+	}
+
+	// Other regions go on meanwhile
+	a.Admit(newAdmissionBot("b1", "b"))
+	if d := time.Until(time.Unix(0, s.tasks[0].task.Time)); d > time.Second {
+		t.Fatalf("login waits for the paused region, next in %s", d)
+	}
+	runAdmission(t, s)
+	if len(logins) != 1 || logins[0] != "b1" {
+		t.Fatalf("expected b1 to log in, got %v", logins)
+	}
+
+	// A success resets the backoff
+	a.Success("a")
+	a.regions["a"].next = 0
+	a.RateLimited("a")
+	if d := time.Until(time.Unix(0, a.regions["a"].next)); d > time.Minute {
+		t.Fatalf("backoff not reset, next in %s", d)
+	}
+
+	// Bots which disconnected meanwhile are skipped
+	a.regions["a"].next = 0
+	a.regions["a"].bots[0].status = DISCONNECTED
+	time.Sleep(2 * time.Millisecond)
+	runAdmission(t, s)
+	if len(logins) != 1 || a.Waiting() != 0 {
+		t.Fatalf("disconnected bot logged in, got %v", logins)
+	}
+}
+
+func TestProxyRegion(t *testing.T) {
+
+	a := proxyRegion("proxy:1080", "user", "session-1")
+	if a != proxyRegion("proxy:1080", "user", "session-1") {
+		t.Fatal("same session in different regions")
+	}
+	if a == proxyRegion("proxy:1080", "user", "session-2") || a == proxyRegion("proxy:1080", "other", "session-1") {
+		t.Fatal("different sessions in the same region")
+	}
+	if strings.Contains(a, "session-1") {
+		t.Fatalf("password in region %s", a)
+	}
+}
@@ -0,0 +1,77 @@
+package inspect
+
+import (
+	"net"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+// LoginAction is what a bot does after Steam refused its login
+type LoginAction uint8
+
+const (
+	LoginRetry    LoginAction = iota // Reconnect after the delay, with backoff
+	LoginReAuth                      // Clear the token and log in with the credentials again
+	LoginSwitchCM                    // Blacklist the CM for this region and connect to another one
+	LoginDisable                     // Stop the bot for good and emit BotDisabled
+)
+
+// LoginPolicy is the action for an EResult, Delay is the minimum before reconnecting
+type LoginPolicy struct {
+	Action LoginAction
+	Delay  time.Duration
+}
+
+// Used for EResults without policy
+var defaultLoginPolicy = LoginPolicy{Action: LoginRetry, Delay: time.Minute}
+
+// DefaultLoginPolicies returns the policies used by the Handler, Config.LoginPolicies overrides single entries
+func DefaultLoginPolicies() map[steamlang.EResult]LoginPolicy {
+	return map[steamlang.EResult]LoginPolicy{
+		steamlang.EResult_Expired:                    {Action: LoginReAuth},
+		steamlang.EResult_InvalidLoginAuthCode:       {Action: LoginReAuth, Delay: 30 * time.Second}, // Wait for the next code
+		steamlang.EResult_TwoFactorCodeMismatch:      {Action: LoginReAuth, Delay: 30 * time.Second},
+		steamlang.EResult_TryAnotherCM:               {Action: LoginSwitchCM},
+		steamlang.EResult_ServiceUnavailable:         {Action: LoginSwitchCM},
+		steamlang.EResult_RateLimitExceeded:          {Action: LoginRetry, Delay: time.Minute},
+		steamlang.EResult_AccountLoginDeniedThrottle: {Action: LoginRetry, Delay: 30 * time.Minute},
+		steamlang.EResult_InvalidPassword:            {Action: LoginDisable},
+		steamlang.EResult_AccountDisabled:            {Action: LoginDisable},
+		steamlang.EResult_Banned:                     {Action: LoginDisable},
+		steamlang.EResult_AccountLockedDown:          {Action: LoginDisable},
+	}
+}
+
+func (h *Handler) loginPolicy(result steamlang.EResult) LoginPolicy {
+	if policy, ok := h.loginPolicies[result]; ok {
+		return policy
+	}
+	return defaultLoginPolicy
+}
+
+// handleLoginFailure applies the policy of the EResult the login failed with
+func (h *Handler) handleLoginFailure(bot *Bot, conn net.Conn, result steamlang.EResult, err error) {
+
+	if steamSide(result) {
+		h.steamFailure(bot, err)
+	}
+
+	policy := h.loginPolicy(result)
+	switch policy.Action {
+	case LoginDisable:
+		h.disableBot(bot, conn, err)
+	case LoginReAuth:
+		// Logging in with the token again would fail the same way
+		if dbErr := h.tokenDB.SetToken(bot.Name, ""); dbErr != nil {
+			h.tokenError(bot, conn, dbErr)
+			return
+		}
+		h.handleError(bot, conn, policy.Delay, err)
+	case LoginSwitchCM:
+		h.cms.Failure(bot.getRegion(), bot.getCM())
+		h.handleError(bot, conn, policy.Delay, err)
+	default:
+		h.handleError(bot, conn, policy.Delay, err)
+	}
+}
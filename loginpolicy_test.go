@@ -0,0 +1,76 @@
+package inspect
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+func TestLoginDisable(t *testing.T) {
+
+	events := make(eventChan, 8)
+	h, s := newTestHandler(t, &Config{EventHandler: events})
+	bot, _ := newHeartbeatBot(h, "bot")
+	bot.status = DISCONNECTED // Nothing to disconnect
+
+	h.handleLoginFailure(bot, nil, steamlang.EResult_InvalidPassword, errors.New("invalid password"))
+
+	expectEvent(t, events, BotDisabled)
+	if !bot.disabled.Load() || bot.disabledReason != "invalid password" {
+		t.Fatalf("expected disabled with reason, got %t %q", bot.disabled.Load(), bot.disabledReason)
+	}
+	if len(s.tasks) != 0 {
+		t.Fatal("disabled bot reconnects")
+	}
+}
+
+func TestLoginReAuth(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	db := memoryDB{"bot": "token"}
+	h.tokenDB = db
+	bot, conn := newHeartbeatBot(h, "bot")
+	bot.Password = "password"
+	bot.status = DISCONNECTED
+
+	h.handleLoginFailure(bot, nil, steamlang.EResult_Expired, errors.New("expired"))
+
+	if db["bot"] != "" {
+		t.Fatal("token not cleared")
+	}
+	if len(s.tasks) != 1 {
+		t.Fatalf("expected a reconnect, got %d tasks", len(s.tasks))
+	}
+
+	// The next login starts with the credentials instead of a token logon
+	h.loginBot(bot)
+	expectWrite(t, conn, steamlang.EMsg_ClientHello)
+}
+
+func TestLoginSwitchCM(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	cms := NewCMSelector([]string{"a", "b"})
+	h.cms = cms
+	bot, _ := newHeartbeatBot(h, "bot")
+	bot.cms = cms
+	bot.status = DISCONNECTED
+	cm := "a"
+	bot.cm.Store(&cm)
+
+	h.handleLoginFailure(bot, nil, steamlang.EResult_TryAnotherCM, errors.New("try another CM"))
+
+	if cms.regions[""]["a"].blacklisted == 0 {
+		t.Fatal("CM not marked failed")
+	}
+	if len(s.tasks) != 1 {
+		t.Fatalf("expected a reconnect, got %d tasks", len(s.tasks))
+	}
+
+	// Reconnects to the other CM
+	s.take(s.tasks[0].task).Value.(func())()
+	if got := bot.getCM(); got != "b" {
+		t.Fatalf("expected CM b, got %s", got)
+	}
+}
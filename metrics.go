@@ -6,8 +6,39 @@ type MetricsLogger interface {
 	LogLookup(name string, duration time.Duration, timestamp *time.Time, err bool)
 }
 
+// The following are optional, a MetricsLogger implementing them gets the according metrics as well
+
+// PollerMetrics records failures of the poller
+type PollerMetrics interface {
+	LogPollerError(rebuilt bool, timestamp *time.Time)
+}
+
+// PoolMetrics records the utilization of the pool periodically
+type PoolMetrics interface {
+	LogPool(stats *PoolStats, timestamp *time.Time)
+}
+
+// IngameMetrics records the time from connecting to the GC welcome
+type IngameMetrics interface {
+	LogIngame(name string, duration time.Duration, timestamp *time.Time)
+}
+
 type StubMetrics struct{}
 
 func (s *StubMetrics) LogLookup(string, time.Duration, *time.Time, bool) {
 	// No-op
 }
+
+func (h *Handler) logPollerError(rebuilt bool) {
+	if m, ok := h.metricsLogger.(PollerMetrics); ok {
+		now := time.Now()
+		m.LogPollerError(rebuilt, &now)
+	}
+}
+
+func (h *Handler) logIngame(bot *Bot, duration time.Duration) {
+	if m, ok := h.metricsLogger.(IngameMetrics); ok {
+		now := time.Now()
+		m.LogIngame(bot.Name, duration, &now)
+	}
+}
@@ -0,0 +1,252 @@
+package inspect
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+const outageReconnectSpacing = 100 * time.Millisecond // Between parked bots once Steam is back up
+
+type Health uint8
+
+const (
+	SteamUp Health = iota
+	SteamDown
+)
+
+var healthNames = [...]string{
+	SteamUp:   "UP",
+	SteamDown: "DOWN",
+}
+
+func (s Health) String() string {
+	if int(s) < len(healthNames) {
+		return healthNames[s]
+	}
+	return "UNKNOWN"
+}
+
+func (s Health) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SteamStatus is the health of Steam as seen by the bots of a Handler
+type SteamStatus struct {
+	Health Health
+	Since  time.Time // Last change of the health, zero if it never changed
+	Probe  string    // Bot probing Steam while it is down
+	Parked int       // Bots waiting for the probe to reconnect
+}
+
+// outageDetector correlates failures across bots, many bots failing within the window means Steam is down.
+// While it is down, only the probe reconnects, the others are parked until the probe is ingame again.
+type outageDetector struct {
+	window    time.Duration
+	threshold float64 // Fraction of bots
+	minBots   int
+
+	health   atomic.Uint32 // Health, read without the mutex by Inspect
+	since    time.Time
+	failures map[uint64]time.Time // Map Bot ID to the last failure
+	probe    *Bot
+	parked   []*Bot
+	mutex    sync.Mutex
+}
+
+func newOutageDetector(window time.Duration, threshold float64, minBots int) *outageDetector {
+
+	if window <= 0 {
+		window = time.Minute
+	}
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	if minBots <= 0 {
+		minBots = 3
+	}
+
+	return &outageDetector{
+		window:    window,
+		threshold: threshold,
+		minBots:   minBots,
+		failures:  make(map[uint64]time.Time),
+	}
+}
+
+func (o *outageDetector) Health() Health {
+	return Health(o.health.Load())
+}
+
+// failure records a failed bot out of total bots, it returns true if Steam went down
+func (o *outageDetector) failure(bot *Bot, total int, now time.Time) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.failures[bot.id] = now
+	if o.Health() == SteamDown {
+		return false
+	}
+
+	for id, t := range o.failures {
+		if now.Sub(t) > o.window {
+			delete(o.failures, id)
+		}
+	}
+
+	n := len(o.failures)
+	if n < o.minBots || float64(n) < o.threshold*float64(total) {
+		return false
+	}
+
+	o.health.Store(uint32(SteamDown))
+	o.since = now
+	return true
+}
+
+// park returns true if the bot must not reconnect, the first bot to ask while Steam is down becomes the probe
+func (o *outageDetector) park(bot *Bot) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.Health() == SteamUp {
+		return false
+	}
+	if o.probe == nil || o.probe == bot {
+		o.probe = bot
+		return false
+	}
+	if !slices.Contains(o.parked, bot) {
+		o.parked = append(o.parked, bot)
+	}
+	return true
+}
+
+// success records a bot getting ingame, it returns the parked bots if Steam is back up
+func (o *outageDetector) success(bot *Bot, now time.Time) (up bool, parked []*Bot) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.failures, bot.id)
+	if o.Health() == SteamUp {
+		return false, nil
+	}
+
+	o.health.Store(uint32(SteamUp))
+	o.since = now
+	o.probe = nil
+	parked, o.parked = o.parked, nil
+	clear(o.failures)
+
+	return true, parked
+}
+
+// remove forgets a removed or disabled bot, it returns the next probe if the bot was the probe
+func (o *outageDetector) remove(bot *Bot) *Bot {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.failures, bot.id)
+	if i := slices.Index(o.parked, bot); i >= 0 {
+		o.parked = slices.Delete(o.parked, i, i+1)
+	}
+
+	if o.probe != bot {
+		return nil
+	}
+	o.probe = nil
+	if len(o.parked) == 0 {
+		return nil
+	}
+	o.probe, o.parked = o.parked[0], o.parked[1:]
+	return o.probe
+}
+
+func (o *outageDetector) status() SteamStatus {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	status := SteamStatus{
+		Health: o.Health(),
+		Since:  o.since,
+		Parked: len(o.parked),
+	}
+	if o.probe != nil {
+		status.Probe = o.probe.Name
+	}
+	return status
+}
+
+// steamSide reports whether Steam failed the login itself.
+// Failures of the account, the proxy, rate limits and throttling don't tell anything about Steam.
+func steamSide(result steamlang.EResult) bool {
+	return result == steamlang.EResult_ServiceUnavailable || result == steamlang.EResult_TryAnotherCM
+}
+
+// errCMClosed marks a connect the CM closed after it was dialed, unlike dial and proxy errors
+var errCMClosed = errors.New("connection closed by CM")
+
+// closedByCM reports whether the CM closed or reset the connection.
+// Timeouts and other network errors might as well be the proxy or our own network.
+func closedByCM(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, errWSClosed)
+}
+
+// steamFailure counts the failure of the bot towards an outage.
+// Only failures on the side of Steam count, the CM closing the connection, refusing logins or the GC dropping the session.
+func (h *Handler) steamFailure(bot *Bot, err error) {
+
+	if !h.outage.failure(bot, int(h.botCount.Load()), time.Now()) {
+		return
+	}
+
+	h.log.Error().
+		Err(err).
+		Msg("Steam is down, pausing reconnects")
+
+	h.emit(SteamOutage, nil, err)
+}
+
+// steamSuccess ends an outage once a bot got ingame, the parked bots reconnect spread out
+func (h *Handler) steamSuccess(bot *Bot) {
+
+	up, parked := h.outage.success(bot, time.Now())
+	if !up {
+		return
+	}
+
+	h.log.Info().
+		Str("probe", bot.Name).
+		Int("parked", len(parked)).
+		Msg("Steam is back up, resuming reconnects")
+
+	h.emit(SteamRecovered, bot, nil)
+
+	for i, b := range parked {
+		h.scheduleReconnect(b, time.Duration(i)*outageReconnectSpacing)
+	}
+}
+
+// forgetBot hands the probe over to a parked bot, if the removed or disabled bot was the probe
+func (h *Handler) forgetBot(bot *Bot) {
+	if next := h.outage.remove(bot); next != nil {
+		h.scheduleReconnect(next, 0)
+	}
+}
+
+// SteamDown reports whether Steam or the GC is down, Inspect queues nothing meanwhile
+func (h *Handler) SteamDown() bool {
+	return h.outage.Health() == SteamDown
+}
+
+// GetSteamStatus returns the health of Steam as seen by the bots
+func (h *Handler) GetSteamStatus() SteamStatus {
+	return h.outage.status()
+}
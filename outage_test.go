@@ -0,0 +1,173 @@
+package inspect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+
+	"github.com/0xAozora/cs2-inspect/types"
+
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOutageDetector(t *testing.T) {
+
+	o := newOutageDetector(time.Minute, 0.5, 3)
+	now := time.Now()
+
+	bots := make([]*Bot, 8)
+	for i := range bots {
+		bots[i] = &Bot{id: uint64(i + 1)}
+	}
+
+	// Failures outside the window don't correlate
+	o.failure(bots[0], len(bots), now.Add(-2*time.Minute))
+	for _, bot := range bots[1:4] {
+		if o.failure(bot, len(bots), now) {
+			t.Fatal("down below the threshold")
+		}
+	}
+	if !o.failure(bots[4], len(bots), now) {
+		t.Fatal("not down at the threshold")
+	}
+	if o.Health() != SteamDown {
+		t.Fatalf("expected DOWN, got %s", o.Health())
+	}
+
+	// The first bot becomes the probe, the others are parked
+	if o.park(bots[1]) {
+		t.Fatal("probe parked")
+	}
+	for _, bot := range bots[2:5] {
+		if !o.park(bot) {
+			t.Fatal("bot not parked")
+		}
+	}
+	if o.park(bots[1]) {
+		t.Fatal("probe parked on its next failure")
+	}
+
+	// Removing the probe hands over to a parked bot
+	if next := o.remove(bots[1]); next != bots[2] {
+		t.Fatal("probe not handed over")
+	}
+	if s := o.status(); s.Parked != 2 {
+		t.Fatalf("expected 2 parked, got %d", s.Parked)
+	}
+
+	up, parked := o.success(bots[2], now)
+	if !up || len(parked) != 2 {
+		t.Fatalf("expected up with 2 parked, got %t with %d", up, len(parked))
+	}
+	if o.Health() != SteamUp || o.park(bots[3]) {
+		t.Fatal("still down after success")
+	}
+
+	// Too few bots never count as an outage
+	o = newOutageDetector(time.Minute, 0.5, 3)
+	o.failure(bots[0], 2, now)
+	if o.failure(bots[1], 2, now) {
+		t.Fatal("down with less than minBots")
+	}
+}
+
+func TestInspectSteamDown(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+	h.outage.health.Store(uint32(SteamDown))
+
+	request := types.Request{L: []*types.Info{{}}}
+	if n, c := h.Inspect(&request, request.L); n != 0 || c != nil || !h.SteamDown() {
+		t.Fatalf("expected nothing queued while Steam is down, got %d", n)
+	}
+}
+
+func TestOutageSteamSideOnly(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+
+	bots := make([]*Bot, 4)
+	for i := range bots {
+		bots[i], _ = newHeartbeatBot(h, fmt.Sprint(i))
+		bots[i].client.Conn = nil // Nothing to disconnect
+	}
+
+	// Rate limits, throttling and broken proxies of every bot don't mean Steam is down
+	for _, bot := range bots {
+		h.handleLoginFailure(bot, nil, steamlang.EResult_RateLimitExceeded, errors.New("rate limited"))
+		h.handleLoginFailure(bot, nil, steamlang.EResult_AccountLoginDeniedThrottle, errors.New("throttled"))
+		h.handleError(bot, nil, 0, errors.New("proxy refused"))
+	}
+	if health := h.outage.Health(); health != SteamUp {
+		t.Fatalf("expected UP, got %s", health)
+	}
+
+	for _, bot := range bots[:3] {
+		bot.status = LOGGED_IN
+		h.handleLoginFailure(bot, nil, steamlang.EResult_ServiceUnavailable, errors.New("service unavailable"))
+	}
+	if health := h.outage.Health(); health != SteamDown {
+		t.Fatalf("expected DOWN, got %s", health)
+	}
+}
+
+func TestOutageLoggedOff(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+
+	bots := make([]*Bot, 4)
+	for i := range bots {
+		bots[i], _ = newHeartbeatBot(h, fmt.Sprint(i))
+		bots[i].client.Conn = nil // Nothing to disconnect
+	}
+
+	loggedOff := func(bot *Bot) {
+		h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientLoggedOff,
+			&protobuf.CMsgClientLoggedOff{Eresult: proto.Int32(int32(steamlang.EResult_ServiceUnavailable))}))
+	}
+
+	for _, bot := range bots[:3] {
+		loggedOff(bot)
+		if bot.status != DISCONNECTED {
+			t.Fatalf("expected DISCONNECTED, got %s", bot.status)
+		}
+	}
+	if health := h.outage.Health(); health != SteamDown {
+		t.Fatalf("expected DOWN, got %s", health)
+	}
+
+	// The bot which took Steam down probes, the next one waits for it
+	loggedOff(bots[3])
+	if status := h.GetSteamStatus(); status.Probe != bots[2].Name || status.Parked != 1 {
+		t.Fatalf("expected probe %s and 1 parked, got %+v", bots[2].Name, status)
+	}
+}
+
+func TestClosedByCM(t *testing.T) {
+
+	for _, c := range []struct {
+		err    error
+		closed bool
+	}{
+		{io.EOF, true},
+		{fmt.Errorf("reading: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{errWSClosed, true},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, false},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, false},
+		{errors.New("proxy: SOCKS5 proxy at 127.0.0.1:1080 has unexpected version 0"), false},
+	} {
+		if closed := closedByCM(c.err); closed != c.closed {
+			t.Fatalf("%v: expected %t, got %t", c.err, c.closed, closed)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package inspect
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/0xAozora/epoller"
+)
+
+// ErrPollerClosed is returned by Wait after the poller has been closed
+var ErrPollerClosed = errors.New("poller closed")
+
+// ConnPoller notifies the Handler about bot connections ready to be read
+type ConnPoller interface {
+	Add(conn net.Conn, fd uint64) error
+	// Remove unregisters the connection, conn is the one passed to Add
+	Remove(conn net.Conn, fd uint64) error
+	// Wait blocks until connections are readable and returns up to count of them.
+	// Connections returned by the previous call have been read when Wait is called again.
+	Wait(count int) ([]net.Conn, error)
+	Close() error
+}
+
+// epollPoller is the default ConnPoller, a single epoll instance for all bots
+type epollPoller struct {
+	poller epoller.Poller
+}
+
+// NewEpollPoller creates a ConnPoller backed by epoll (kqueue on BSD)
+func NewEpollPoller(size int) (ConnPoller, error) {
+	poller, err := epoller.NewPoller(size, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &epollPoller{poller: poller}, nil
+}
+
+func (p *epollPoller) Add(conn net.Conn, fd uint64) error {
+	return p.poller.Add(conn, fd)
+}
+
+func (p *epollPoller) Remove(_ net.Conn, fd uint64) error {
+	return p.poller.Remove(fd)
+}
+
+func (p *epollPoller) Wait(count int) ([]net.Conn, error) {
+	return p.poller.Wait(count)
+}
+
+func (p *epollPoller) Close() error {
+	return p.poller.Close(false)
+}
+
+// goroutinePoller is a ConnPoller with a goroutine per connection
+// waiting for readiness through the runtime network poller.
+// It is slower and uses more memory than epoll, but works wherever Go does.
+// Connections are keyed on the net.Conn itself, the fd passed along is ignored.
+// Connections without file descriptor are watched with a blocking peek, if they implement readWaiter.
+type goroutinePoller struct {
+	conns map[net.Conn]*polledConn
+	mutex sync.Mutex
+
+	ready  chan *polledConn
+	last   []*polledConn // Returned by the last Wait, rearmed on the next one
+	buf    []net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+type polledConn struct {
+	conn net.Conn
+	wait func() error // Blocks until the connection is readable
+	arm  chan struct{}
+	done chan struct{}
+}
+
+// readWaiter is implemented by connections which can wait for data without consuming it
+type readWaiter interface {
+	WaitReadable() error
+}
+
+// connKeyed reports whether the poller keys connections on the net.Conn,
+// such a poller doesn't need file descriptors
+func connKeyed(poller ConnPoller) bool {
+	_, ok := poller.(*goroutinePoller)
+	return ok
+}
+
+// NewGoroutinePoller creates a ConnPoller using a goroutine per connection
+func NewGoroutinePoller() ConnPoller {
+	return &goroutinePoller{
+		conns:  make(map[net.Conn]*polledConn),
+		ready:  make(chan *polledConn, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func (p *goroutinePoller) Add(conn net.Conn, fd uint64) error {
+
+	pc := &polledConn{
+		conn: conn,
+		arm:  make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	if raw, err := syscallConn(conn); err == nil {
+		pc.wait = func() error {
+			return raw.Read(readable())
+		}
+	} else if w, ok := conn.(readWaiter); ok {
+		pc.wait = w.WaitReadable
+	} else {
+		return err
+	}
+
+	p.mutex.Lock()
+	if old := p.conns[conn]; old != nil {
+		close(old.done)
+	}
+	p.conns[conn] = pc
+	p.mutex.Unlock()
+
+	go p.watch(pc)
+
+	return nil
+}
+
+func (p *goroutinePoller) Remove(conn net.Conn, _ uint64) error {
+
+	p.mutex.Lock()
+	pc := p.conns[conn]
+	delete(p.conns, conn)
+	p.mutex.Unlock()
+
+	if pc == nil {
+		return errors.New("connection not registered")
+	}
+
+	// The goroutine exits once the connection gets closed
+	close(pc.done)
+	return nil
+}
+
+// watch reports the connection as ready whenever it is readable,
+// and waits for it to be read before watching it again
+func (p *goroutinePoller) watch(pc *polledConn) {
+	for {
+		// An error means the connection broke, which the reader has to find out about as well
+		_ = pc.wait()
+
+		select {
+		case p.ready <- pc:
+		case <-pc.done:
+			return
+		case <-p.closed:
+			return
+		}
+
+		select {
+		case <-pc.arm:
+		case <-pc.done:
+			return
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *goroutinePoller) Wait(count int) ([]net.Conn, error) {
+
+	for _, pc := range p.last {
+		pc.arm <- struct{}{}
+	}
+	p.last = p.last[:0]
+
+	var pc *polledConn
+	select {
+	case pc = <-p.ready:
+	case <-p.closed:
+		return nil, ErrPollerClosed
+	}
+
+	conns := p.buf[:0]
+collect:
+	for {
+		select {
+		case <-pc.done:
+			// Removed while waiting in the queue
+		default:
+			p.last = append(p.last, pc)
+			conns = append(conns, pc.conn)
+		}
+
+		if len(conns) >= count {
+			break
+		}
+
+		select {
+		case pc = <-p.ready:
+		default:
+			break collect
+		}
+	}
+	p.buf = conns
+
+	return conns, nil
+}
+
+func (p *goroutinePoller) Close() error {
+	p.once.Do(func() {
+		close(p.closed)
+	})
+	return nil
+}
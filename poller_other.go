@@ -0,0 +1,16 @@
+//go:build !unix
+
+package inspect
+
+// readable returns the callback for syscall.RawConn.Read, returning false makes the runtime wait for readability.
+// Without a non-blocking peek we rely on the runtime calling it again once data arrived.
+func readable() func(uintptr) bool {
+	var waited bool
+	return func(uintptr) bool {
+		if waited {
+			return true
+		}
+		waited = true
+		return false
+	}
+}
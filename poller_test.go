@@ -0,0 +1,175 @@
+package inspect
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Connections without file descriptor, like net.Pipe, are watched through the buffered connection of the bot
+func TestGoroutinePollerPipe(t *testing.T) {
+
+	ciph, burst := testBurst(t, 2)
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := newTCPConnection(client)
+	conn.ciph = ciph
+	fc := &fdConn{Conn: client, reader: conn}
+
+	poller := NewGoroutinePoller()
+	defer poller.Close()
+
+	// Neither file descriptor nor a reader to wait on
+	other, _ := net.Pipe()
+	if err := poller.Add(other, 0); !errors.Is(err, ErrNotPollable) {
+		t.Fatalf("expected ErrNotPollable, got %v", err)
+	}
+
+	if err := poller.Add(fc, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	go server.Write(burst)
+
+	conns, err := poller.Wait(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 1 || conns[0] != fc {
+		t.Fatalf("expected the pipe to be ready, got %v", conns)
+	}
+	for range 2 {
+		if _, err = conn.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not ready again until there is more data
+	ready := make(chan []net.Conn)
+	go func() {
+		conns, _ := poller.Wait(10)
+		ready <- conns
+	}()
+
+	select {
+	case conns = <-ready:
+		t.Fatalf("ready without data, got %v", conns)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	go server.Write(burst)
+
+	if conns = <-ready; len(conns) != 1 || conns[0] != fc {
+		t.Fatalf("expected the pipe to be ready again, got %v", conns)
+	}
+
+	if err = poller.Remove(fc, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = poller.Remove(fc, 0); err == nil {
+		t.Fatal("removed twice")
+	}
+	client.Close()
+
+	poller.Close()
+	if _, err = poller.Wait(10); !errors.Is(err, ErrPollerClosed) {
+		t.Fatalf("expected ErrPollerClosed, got %v", err)
+	}
+}
+
+// brokenPoller fails for good once broken is closed
+type brokenPoller struct {
+	broken chan struct{}
+	closed chan struct{}
+}
+
+func (p *brokenPoller) Add(net.Conn, uint64) error    { return nil }
+func (p *brokenPoller) Remove(net.Conn, uint64) error { return nil }
+
+func (p *brokenPoller) Wait(int) ([]net.Conn, error) {
+	<-p.broken
+	return nil, errors.New("poller broken")
+}
+
+func (p *brokenPoller) Close() error {
+	close(p.closed)
+	return nil
+}
+
+type eventChan chan EventType
+
+func (c eventChan) HandleEvent(e *Event) {
+	c <- e.T
+}
+
+func expectEvent(t *testing.T, events eventChan, expected EventType) {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e != expected {
+			t.Fatalf("expected %s, got %s", expected, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no %s", expected)
+	}
+}
+
+func TestPollerRebuild(t *testing.T) {
+
+	broken := &brokenPoller{broken: make(chan struct{}), closed: make(chan struct{})}
+	replacement := NewGoroutinePoller()
+	events := make(eventChan, 8)
+
+	// The first replacement fails as well
+	var attempts int
+	h, _ := newTestHandler(t, &Config{
+		Poller: broken,
+		NewPoller: func() (ConnPoller, error) {
+			if attempts++; attempts == 1 {
+				return nil, errors.New("no poller")
+			}
+			return replacement, nil
+		},
+		EventHandler: events,
+	})
+
+	logger := zerolog.Nop()
+	bot := NewBot(Credentials{Name: "bot"}, &logger)
+	client, server := net.Pipe()
+	defer server.Close()
+	bot.conn = client
+	bot.client.Conn = newTCPConnection(client)
+	bot.fd = 1
+
+	h.botMutex.Lock()
+	h.bots.Store(bot.fd, bot)
+	h.botMutex.Unlock()
+
+	close(broken.broken)
+
+	expectEvent(t, events, PollerError)
+	expectEvent(t, events, PollerRebuilt)
+
+	select {
+	case <-broken.closed:
+	default:
+		t.Fatal("broken poller not closed")
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+
+	// Registered again, waiting on the buffered connection of the bot
+	polled := bot.polled.Load()
+	if polled == nil || polled.reader == nil {
+		t.Fatal("bot not registered in the replacement")
+	}
+	if err := replacement.Remove(polled, bot.fd); err != nil {
+		t.Fatal(err)
+	}
+}
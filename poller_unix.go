@@ -0,0 +1,17 @@
+//go:build unix
+
+package inspect
+
+import "syscall"
+
+// readable returns the callback for syscall.RawConn.Read, returning false makes the runtime wait for readability.
+// We peek instead of reading, the data is left for the steam.Client.
+func readable() func(uintptr) bool {
+	return peek
+}
+
+func peek(fd uintptr) bool {
+	var b [1]byte
+	_, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	return err != syscall.EAGAIN
+}
@@ -2,6 +2,9 @@ package inspect
 
 import (
 	"fmt"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +16,25 @@ var ErrScheduleTimeout = fmt.Errorf("schedule error: timed out")
 type Pool struct {
 	sem  chan struct{}
 	work chan func()
+
+	busy     atomic.Int32
+	panics   atomic.Uint64
+	rejected atomic.Uint64
+
+	// PanicHandler is called with the value and stack of a panic recovered from a task.
+	// Set it before scheduling, the panic is printed to stderr if it is nil.
+	PanicHandler func(v any, stack []byte)
+}
+
+// PoolStats is a snapshot of the utilization of a Pool
+type PoolStats struct {
+	Size     int    // Maximum amount of workers
+	Workers  int    // Spawned workers
+	Busy     int    // Workers running a task
+	Queued   int    // Tasks waiting for a worker
+	QueueCap int    // Capacity of the queue
+	Panics   uint64 // Recovered panics
+	Rejected uint64 // Tasks not scheduled by TrySchedule or ScheduleTimeout
 }
 
 // NewPool creates new goroutine pool with given cap. It also creates a work
@@ -45,7 +67,28 @@ func (p *Pool) Schedule(task func()) {
 // ScheduleTimeout schedules task to be executed over pool's workers.
 // It returns ErrScheduleTimeout when no free workers met during given timeout.
 func (p *Pool) ScheduleTimeout(timeout time.Duration, task func()) error {
-	return p.schedule(task, time.After(timeout))
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	err := p.schedule(task, t.C)
+	if err != nil {
+		p.rejected.Add(1)
+	}
+	return err
+}
+
+// TrySchedule schedules task only if a worker or a queue slot is free right now.
+func (p *Pool) TrySchedule(task func()) bool {
+	select {
+	case p.work <- task:
+		return true
+	case p.sem <- struct{}{}:
+		go p.worker(task)
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
 }
 
 func (p *Pool) schedule(task func(), timeout <-chan time.Time) error {
@@ -60,14 +103,66 @@ func (p *Pool) schedule(task func(), timeout <-chan time.Time) error {
 	}
 }
 
+// Stats returns the current utilization of the pool
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Size:     cap(p.sem),
+		Workers:  len(p.sem),
+		Busy:     int(p.busy.Load()),
+		Queued:   len(p.work),
+		QueueCap: cap(p.work),
+		Panics:   p.panics.Load(),
+		Rejected: p.rejected.Load(),
+	}
+}
+
+// Recover is deferred by tasks which handle their own panics with more context.
+// Those are counted in the stats like the ones recovered by the pool.
+func (p *Pool) Recover(handle func(v any, stack []byte)) {
+	if v := recover(); v != nil {
+		p.panics.Add(1)
+		handle(v, debug.Stack())
+	}
+}
+
 func (p *Pool) worker(task func()) {
 	//defer func() { <-p.sem }()
 
-	task()
+	p.run(task)
 
 	for task := range p.work {
-		task()
+		p.run(task)
 	}
 
 	<-p.sem
 }
+
+// run executes the task, a panic must not take down the worker or the process
+func (p *Pool) run(task func()) {
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+	defer p.Recover(p.panicHandler)
+
+	task()
+}
+
+func (p *Pool) panicHandler(v any, stack []byte) {
+	if p.PanicHandler != nil {
+		p.PanicHandler(v, stack)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "pool: recovered panic: %v\n%s", v, stack)
+}
+
+// OverloadPolicy decides what happens to a packet when all workers are busy and the queue is full
+//
+// With OverloadCallerRuns, the goroutine reading all bot connections handles the packet itself.
+// No bot is read until it is done, so everything the handler of the packet does stalls all bots,
+// including the TokenDB and the AuthenticationHandler, which must not wait on other packets meanwhile.
+type OverloadPolicy uint8
+
+const (
+	OverloadBlock      OverloadPolicy = iota // Wait for a worker, reading of all bots stalls meanwhile
+	OverloadCallerRuns                       // Handle the packet on the poller goroutine, see below
+	OverloadDrop                             // Drop the packet if no worker gets free within the timeout
+)
@@ -0,0 +1,145 @@
+package inspect
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+func TestPoolRecover(t *testing.T) {
+
+	p := NewPool(1, 0, 0)
+	recovered := make(chan any, 1)
+	p.PanicHandler = func(v any, stack []byte) {
+		recovered <- v
+	}
+
+	p.Schedule(func() { panic("task") })
+	select {
+	case v := <-recovered:
+		if v != "task" {
+			t.Fatalf("unexpected panic %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not recovered")
+	}
+
+	// The worker survived
+	done := make(chan struct{})
+	p.Schedule(func() { close(done) })
+	<-done
+
+	// Tasks recovering on their own are counted as well
+	var handled any
+	func() {
+		defer p.Recover(func(v any, stack []byte) {
+			handled = v
+		})
+		panic("own")
+	}()
+	if handled != "own" {
+		t.Fatalf("unexpected panic %v", handled)
+	}
+
+	if panics := p.Stats().Panics; panics != 2 {
+		t.Fatalf("expected 2 panics, got %d", panics)
+	}
+}
+
+func TestPoolTrySchedule(t *testing.T) {
+
+	p := NewPool(1, 0, 0)
+	release := make(chan struct{})
+
+	if !p.TrySchedule(func() { <-release }) {
+		t.Fatal("not scheduled on a free pool")
+	}
+	if p.TrySchedule(func() {}) {
+		t.Fatal("scheduled on a busy pool")
+	}
+	if err := p.ScheduleTimeout(10*time.Millisecond, func() {}); !errors.Is(err, ErrScheduleTimeout) {
+		t.Fatalf("expected ErrScheduleTimeout, got %v", err)
+	}
+	if stats := p.Stats(); stats.Rejected != 2 || stats.Busy != 1 {
+		t.Fatalf("expected 2 rejected and 1 busy, got %+v", stats)
+	}
+
+	close(release)
+
+	done := make(chan struct{})
+	if err := p.ScheduleTimeout(time.Second, func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestDispatchOverload(t *testing.T) {
+
+	for _, policy := range []OverloadPolicy{OverloadBlock, OverloadCallerRuns, OverloadDrop} {
+
+		h, _ := newTestHandler(t, &Config{Overload: policy, OverloadTimeout: 10 * time.Millisecond})
+		bot, _ := newHeartbeatBot(h, "bot")
+
+		// The packet is handled once the job handler ran
+		handled := make(chan struct{}, 1)
+		packet := newResponse(t, steamlang.EResult_OK, new(protobuf.CMsgClientHeartBeat))
+		bot.client.JobHandlers[uint64(packet.TargetJobId)] = func(*protocol.Packet) error {
+			handled <- struct{}{}
+			return nil
+		}
+
+		// Saturate the pool, one task running and one queued
+		release := make(chan struct{})
+		h.Pool.Schedule(func() { <-release })
+		h.Pool.Schedule(func() { <-release })
+
+		dispatched := make(chan struct{})
+		go func() {
+			h.dispatchPacket(bot, nil, packet)
+			close(dispatched)
+		}()
+
+		switch policy {
+		case OverloadBlock:
+			select {
+			case <-dispatched:
+				t.Fatal("dispatched on a saturated pool")
+			case <-time.After(20 * time.Millisecond):
+			}
+			close(release)
+			<-dispatched
+			<-handled
+
+		case OverloadCallerRuns:
+			<-dispatched
+			select {
+			case <-handled:
+			default:
+				t.Fatal("packet not handled by the caller")
+			}
+			close(release)
+
+		case OverloadDrop:
+			<-dispatched
+			close(release)
+			select {
+			case <-handled:
+				t.Fatal("packet not dropped")
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+
+		// Only the scheduling attempts giving up count
+		var expected uint64
+		if policy != OverloadBlock {
+			expected = 1
+		}
+		if rejected := h.Pool.Stats().Rejected; rejected != expected {
+			t.Fatalf("policy %d: expected %d rejected, got %d", policy, expected, rejected)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package inspect
 
+import (
+	"fmt"
+	"hash/maphash"
+)
+
 type ProxyList struct {
 	Address  string
 	Username string
@@ -8,3 +13,12 @@ type ProxyList struct {
 	Usernames []string
 	Passwords []string
 }
+
+var regionSeed = maphash.MakeSeed()
+
+// proxyRegion identifies the exit IP of a proxy session, to space out logins and rate CMs per IP.
+// Sticky sessions usually share the address and differ in their credentials, so those are part of it,
+// the password as a fingerprint only, to keep it out of logs and the bot status.
+func proxyRegion(addr, user, password string) string {
+	return fmt.Sprintf("%s@%s#%08x", user, addr, uint32(maphash.String(regionSeed, password)))
+}
@@ -0,0 +1,131 @@
+package inspect
+
+import (
+	"errors"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+// SessionPolicy is what a bot does when its account gets used elsewhere
+type SessionPolicy uint8
+
+const (
+	SessionYield   SessionPolicy = iota // Leave the session to the other client for a while, then take it back
+	SessionReclaim                      // Take the session back right away
+)
+
+const defaultSessionYield = 30 * time.Minute
+
+// Conflicts shown in the bot status
+const (
+	ConflictLoggedIn = "logged in elsewhere"
+	ConflictPlaying  = "playing elsewhere"
+)
+
+// sessionConflict records the conflict and returns how long the bot yields to the other session
+func (h *Handler) sessionConflict(bot *Bot, conflict string) time.Duration {
+
+	var yield time.Duration
+	if h.sessionPolicy == SessionYield {
+		yield = h.sessionYield
+	}
+
+	now := time.Now()
+	bot.setConflict(conflict, now, now.Add(yield))
+
+	h.log.Warn().
+		Str("bot", bot.Name).
+		Str("conflict", conflict).
+		Dur("yield", yield).
+		Msg("Account used elsewhere")
+
+	h.emit(SessionConflict, bot, errors.New(conflict))
+
+	return yield
+}
+
+// handlePlayingSessionState handles another client playing on the account, which takes over the GC session
+func (h *Handler) handlePlayingSessionState(bot *Bot, packet *protocol.Packet) {
+
+	msg := new(protobuf.CMsgClientPlayingSessionState)
+	packet.ReadProtoMsg(msg)
+
+	if !msg.GetPlayingBlocked() {
+		// The other client stopped playing while we yield
+		if conflict, _, until := bot.getConflict(); conflict != "" && time.Now().Before(until) {
+			h.log.Info().
+				Str("bot", bot.Name).
+				Msg("Playing session free again")
+
+			h.reclaimSession(bot, false)
+		}
+		return
+	}
+
+	// No inspects until we are welcomed again, the GC session is given up anyway
+	// The bot stays logged in to the CM, so the heartbeat keeps running
+	if bot.status == INGAME || bot.status == GC_WAITING {
+		bot.status = LOGGED_IN
+	}
+
+	yield := h.sessionConflict(bot, ConflictPlaying)
+	h.scheduleReclaim(bot, time.Now().Add(yield))
+}
+
+// scheduleReclaim takes the session back at until, replacing the hello watchdog meanwhile.
+// No hellos are sent while yielding, they would take the session back early.
+func (h *Handler) scheduleReclaim(bot *Bot, until time.Time) {
+
+	bot.cancelHello()
+
+	task := &Task{
+		T: Function,
+		Value: func() {
+			bot.gcMutex.Lock()
+			bot.reclaim = nil
+			bot.gcMutex.Unlock()
+
+			// The GC might have sent its connection status meanwhile
+			if bot.status != LOGGED_IN && bot.status != GC_WAITING || bot.removed.Load() {
+				return
+			}
+			h.reclaimSession(bot, true)
+		},
+		Time: until.UnixNano(),
+	}
+
+	bot.gcMutex.Lock()
+	if bot.reclaim != nil {
+		bot.reclaim.Cancel()
+	}
+	bot.reclaim = h.scheduler.AddTask(task)
+	bot.gcMutex.Unlock()
+}
+
+// reclaimSession plays CS2 again, kicking the other client if it still plays
+func (h *Handler) reclaimSession(bot *Bot, kick bool) {
+
+	bot.cancelReclaim()
+	bot.endYield()
+
+	var err error
+	if kick {
+		err = bot.client.Write(protocol.NewClientMsgProtobuf(steamlang.EMsg_ClientKickPlayingSession,
+			&protobuf.CMsgClientKickPlayingSession{OnlyStopGame: proto.Bool(true)}))
+	}
+	if err == nil {
+		err = bot.client.GC.SetGamesPlayed(730)
+	}
+	if err == nil {
+		err = h.sendHello(bot)
+	}
+	if err != nil {
+		h.handleError(bot, bot.conn, 0, err)
+		return
+	}
+	h.scheduleHello(bot, 0)
+}
@@ -0,0 +1,174 @@
+package inspect
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+func newPacket(t *testing.T, emsg steamlang.EMsg, body proto.Message) *protocol.Packet {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := protocol.NewClientMsgProtobuf(emsg, body).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.NewPacket(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func expectWrite(t *testing.T, conn *writeConn, emsg steamlang.EMsg) {
+	t.Helper()
+	select {
+	case msg := <-conn.writes:
+		packet, err := protocol.NewPacket(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.EMsg != emsg {
+			t.Fatalf("expected %s, got %s", emsg, packet.EMsg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no %s sent", emsg)
+	}
+}
+
+func runReclaim(t *testing.T, s *manualScheduler, bot *Bot) {
+	t.Helper()
+	if bot.reclaim == nil {
+		t.Fatal("no reclaim scheduled")
+	}
+	task := s.take(bot.reclaim.(*manualHandle).task)
+	if task == nil {
+		t.Fatal("reclaim not in scheduler")
+	}
+	task.Value.(func())()
+}
+
+func TestPlayingSessionYield(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.sessionYield = time.Hour
+	bot, conn := newHeartbeatBot(h, "bot")
+	bot.status = INGAME
+	h.startHeartbeat(bot, 5*time.Second)
+
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientPlayingSessionState,
+		&protobuf.CMsgClientPlayingSessionState{PlayingBlocked: proto.Bool(true), PlayingApp: proto.Uint32(730)}))
+
+	if bot.status != LOGGED_IN {
+		t.Fatalf("expected LOGGED_IN, got %s", bot.status)
+	}
+	if conflict, _, until := bot.getConflict(); conflict != ConflictPlaying || time.Until(until) < 59*time.Minute {
+		t.Fatalf("expected to yield for %s, got %q until %s", h.sessionYield, conflict, until)
+	}
+	if bot.reclaim == nil || bot.hello != nil {
+		t.Fatal("reclaim not scheduled")
+	}
+	if len(s.heartbeats(bot)) != 1 {
+		t.Fatal("heartbeat stopped while yielding")
+	}
+	expectNoWrite(t, conn)
+
+	// The other client stops playing before the yield is over
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientPlayingSessionState,
+		&protobuf.CMsgClientPlayingSessionState{PlayingBlocked: proto.Bool(false)}))
+
+	expectWrite(t, conn, steamlang.EMsg_ClientGamesPlayed)
+	expectHello(t, conn)
+	if bot.reclaim != nil || bot.hello == nil || len(s.tasks) != 2 {
+		t.Fatal("reclaim not replaced by the hello watchdog")
+	}
+	if len(s.heartbeats(bot)) != 1 {
+		t.Fatal("heartbeat stopped after reclaiming")
+	}
+
+	// Shown until the welcome
+	if info := h.GetBotInfos()[0]; info.Conflict != ConflictPlaying {
+		t.Fatalf("expected conflict in status, got %q", info.Conflict)
+	}
+}
+
+func TestPlayingSessionReclaim(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.sessionPolicy = SessionReclaim
+	bot, conn := newHeartbeatBot(h, "bot")
+	bot.status = INGAME
+
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientPlayingSessionState,
+		&protobuf.CMsgClientPlayingSessionState{PlayingBlocked: proto.Bool(true), PlayingApp: proto.Uint32(730)}))
+
+	// Reclaiming runs right away
+	runReclaim(t, s, bot)
+	expectWrite(t, conn, steamlang.EMsg_ClientKickPlayingSession)
+	expectWrite(t, conn, steamlang.EMsg_ClientGamesPlayed)
+	expectHello(t, conn)
+
+	// Our own kick unblocks the session, which doesn't reclaim again
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientPlayingSessionState,
+		&protobuf.CMsgClientPlayingSessionState{PlayingBlocked: proto.Bool(false)}))
+	expectNoWrite(t, conn)
+}
+
+func TestConnectTokensWhileYielding(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.sessionYield = time.Hour
+	bot, conn := newHeartbeatBot(h, "bot")
+	bot.status = INGAME
+
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientPlayingSessionState,
+		&protobuf.CMsgClientPlayingSessionState{PlayingBlocked: proto.Bool(true), PlayingApp: proto.Uint32(730)}))
+	_, _, until := bot.getConflict()
+
+	// Neither the tokens nor a version change send a hello, which would take the session back early
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientGameConnectTokens, &protobuf.CMsgClientGameConnectTokens{}))
+	h.SetGCVersion(h.GCVersion() + 1)
+	expectNoWrite(t, conn)
+
+	if bot.hello != nil || bot.reclaim == nil || len(s.tasks) != 1 {
+		t.Fatal("hello scheduled while yielding")
+	}
+	if s.tasks[0].task.Time != until.UnixNano() {
+		t.Fatal("reclaim not kept at the end of the yield")
+	}
+
+	// Once the yield is over, the session is taken back
+	bot.endYield()
+	runReclaim(t, s, bot)
+	expectWrite(t, conn, steamlang.EMsg_ClientKickPlayingSession)
+	expectWrite(t, conn, steamlang.EMsg_ClientGamesPlayed)
+	expectHello(t, conn)
+}
+
+func TestLoggedInElsewhere(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.sessionYield = time.Hour
+	bot, _ := newHeartbeatBot(h, "bot")
+	bot.status = INGAME
+
+	h.handlePacket(bot, nil, newPacket(t, steamlang.EMsg_ClientLoggedOff, &protobuf.CMsgClientLoggedOff{
+		Eresult: proto.Int32(int32(steamlang.EResult_LoggedInElsewhere)),
+	}))
+
+	if bot.status != CONNECTED {
+		t.Fatalf("expected CONNECTED, got %s", bot.status)
+	}
+	if conflict, _, _ := bot.getConflict(); conflict != ConflictLoggedIn {
+		t.Fatalf("expected %q, got %q", ConflictLoggedIn, conflict)
+	}
+
+	// The login waits for the yield
+	if len(s.tasks) != 1 || time.Until(time.Unix(0, s.tasks[0].task.Time)) < 59*time.Minute {
+		t.Fatal("login not delayed by the yield")
+	}
+}
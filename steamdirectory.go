@@ -0,0 +1,212 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/0xAozora/go-steam"
+)
+
+const steamDirectoryURL = "https://api.steampowered.com/ISteamDirectory/GetCMList/v1/?cellId=0"
+
+var steamDirectoryClient = &http.Client{Timeout: 10 * time.Second}
+
+// CMList is the CM list of the Steam directory
+type CMList struct {
+	Servers    []string  `json:"servers"`
+	WebSockets []string  `json:"websockets"`
+	Time       time.Time `json:"time"` // Time of the fetch
+
+	// Last known good CMs of the transport, fastest first, they are tried first at startup
+	Good []string `json:"good,omitempty"`
+}
+
+// DirectoryStatus reports the state of the Steam directory
+type DirectoryStatus struct {
+	Servers     int       // CMs currently available
+	Cached      bool      // The CM list was loaded from the DirectoryStore and not refreshed since
+	LastRefresh time.Time // Last successful refresh
+	LastAttempt time.Time
+	Err         string // Error of the last attempt, empty if it succeeded
+}
+
+type steamDirectory struct {
+	fetch  func() (*CMList, error)
+	store  DirectoryStore
+	list   *CMList // Last fetched or loaded list
+	status DirectoryStatus
+	mutex  sync.Mutex
+}
+
+// fetchSteamDirectory gets the current CM list from the Steam Web API
+func fetchSteamDirectory() (*CMList, error) {
+
+	resp, err := steamDirectoryClient.Get(steamDirectoryURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r steam.SteamDirectoryResponse
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Response.Result != 1 {
+		return nil, fmt.Errorf("steam directory result: %d, message: %s", r.Response.Result, r.Response.Message)
+	}
+	if len(r.Response.ServerList) == 0 {
+		return nil, fmt.Errorf("steam directory returned zero servers")
+	}
+
+	return &CMList{
+		Servers:    r.Response.ServerList,
+		WebSockets: r.Response.ServerListWebsockets,
+		Time:       time.Now(),
+	}, nil
+}
+
+// loadSteamDirectory loads the cached CM list, returns false if there is none
+func (h *Handler) loadSteamDirectory() bool {
+
+	list, err := h.directory.store.GetCMList()
+	if err != nil {
+		h.log.Err(err).Msg("Error loading cached Steam directory")
+		return false
+	}
+	if list == nil {
+		return false
+	}
+
+	servers := h.cmServers(list)
+	if len(servers) == 0 {
+		return false
+	}
+
+	h.cms.SetServers(servers)
+	h.cms.Prefer(list.Good)
+
+	h.directory.mutex.Lock()
+	h.directory.list = list
+	h.directory.status.Cached = true
+	h.directory.status.LastRefresh = list.Time
+	h.directory.mutex.Unlock()
+
+	h.log.Info().
+		Int("servers", len(servers)).
+		Int("good", len(list.Good)).
+		Time("time", list.Time).
+		Msg("Loaded cached Steam directory")
+
+	return true
+}
+
+// refreshSteamDirectory fetches the CM list and stores it along with the CMs we know to be good
+func (h *Handler) refreshSteamDirectory() {
+
+	list, err := h.directory.fetch()
+
+	h.directory.mutex.Lock()
+	h.directory.status.LastAttempt = time.Now()
+	if err != nil {
+		h.directory.status.Err = err.Error()
+	} else {
+		h.directory.status.Err = ""
+		h.directory.status.Cached = false
+		h.directory.status.LastRefresh = list.Time
+		if h.directory.list != nil {
+			list.Good = h.directory.list.Good
+		}
+		h.directory.list = list
+	}
+	h.directory.mutex.Unlock()
+
+	if err != nil {
+		h.log.Err(err).
+			Int("servers", h.cms.Servers()).
+			Msg("Error refreshing Steam directory")
+	} else {
+		h.cms.SetServers(h.cmServers(list))
+	}
+
+	// Even if the refresh failed, the good CMs might have changed
+	h.saveSteamDirectory()
+}
+
+// saveSteamDirectory persists the current CM list with the current good CMs
+func (h *Handler) saveSteamDirectory() {
+
+	h.directory.mutex.Lock()
+	if h.directory.list == nil {
+		h.directory.mutex.Unlock()
+		return
+	}
+	list := *h.directory.list
+	h.directory.mutex.Unlock()
+
+	// Keep the ones of the last run until we connected somewhere
+	if good := h.cms.GoodList(); len(good) != 0 {
+		list.Good = good
+	}
+	if err := h.directory.store.SetCMList(&list); err != nil {
+		h.log.Err(err).Msg("Error caching Steam directory")
+	}
+}
+
+// cmServers returns the CMs for the transport of the handler
+func (h *Handler) cmServers(list *CMList) []string {
+	if h.transport == WebSocket {
+		return list.WebSockets
+	}
+	return list.Servers
+}
+
+// GetDirectoryStatus returns the refresh status of the Steam directory
+func (h *Handler) GetDirectoryStatus() DirectoryStatus {
+	h.directory.mutex.Lock()
+	defer h.directory.mutex.Unlock()
+
+	status := h.directory.status
+	status.Servers = h.cms.Servers()
+	return status
+}
+
+// FileDirectoryStore is a DirectoryStore persisting the CM list as JSON file
+type FileDirectoryStore struct {
+	Path string
+}
+
+func (s *FileDirectoryStore) GetCMList() (*CMList, error) {
+
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var list CMList
+	if err = json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (s *FileDirectoryStore) SetCMList(list *CMList) error {
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so we never end up with a truncated list
+	tmp := s.Path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
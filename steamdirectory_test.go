@@ -0,0 +1,135 @@
+package inspect
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryDirectoryStore is a DirectoryStore in memory
+type memoryDirectoryStore struct {
+	list  *CMList
+	mutex sync.Mutex
+}
+
+func (s *memoryDirectoryStore) GetCMList() (*CMList, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list, nil
+}
+
+func (s *memoryDirectoryStore) SetCMList(list *CMList) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.list = list
+	return nil
+}
+
+func (s *memoryDirectoryStore) get() *CMList {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.list
+}
+
+func TestSteamDirectoryCache(t *testing.T) {
+
+	store := &memoryDirectoryStore{list: &CMList{
+		Servers: []string{"1.1.1.1:27017", "2.2.2.2:27017", "3.3.3.3:27017"},
+		Time:    time.Now().Add(-time.Hour),
+		Good:    []string{"2.2.2.2:27017"},
+	}}
+
+	var fail bool
+	var mutex sync.Mutex
+	h, _ := newTestHandler(t, &Config{
+		DirectoryStore: store,
+		FetchDirectory: func() (*CMList, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if fail {
+				return nil, errors.New("offline")
+			}
+			return &CMList{Servers: []string{"4.4.4.4:27017", "2.2.2.2:27017"}, Time: time.Now()}, nil
+		},
+	})
+
+	// The refresh at startup doesn't wait with a cached list, let it finish
+	h.refreshSteamDirectory()
+	status := h.GetDirectoryStatus()
+	if status.Cached || status.Err != "" || status.Servers != 2 {
+		t.Fatalf("unexpected status after refresh %+v", status)
+	}
+
+	// The good CMs of the last run are kept until we connected somewhere
+	if list := store.get(); !slices.Equal(list.Servers, []string{"4.4.4.4:27017", "2.2.2.2:27017"}) || !slices.Equal(list.Good, []string{"2.2.2.2:27017"}) {
+		t.Fatalf("unexpected stored list %+v", list)
+	}
+	for range 10 {
+		if cm := h.cms.Select("region"); cm != "2.2.2.2:27017" {
+			t.Fatalf("known good CM not preferred, got %s", cm)
+		}
+	}
+
+	// A failed refresh keeps the list and stores the new good CMs
+	mutex.Lock()
+	fail = true
+	mutex.Unlock()
+	h.cms.Success("region", "4.4.4.4:27017", 10*time.Millisecond)
+	h.refreshSteamDirectory()
+
+	status = h.GetDirectoryStatus()
+	if status.Err != "offline" || status.Servers != 2 || status.LastAttempt.Before(status.LastRefresh) {
+		t.Fatalf("unexpected status after failed refresh %+v", status)
+	}
+	if list := store.get(); len(list.Servers) != 2 || !slices.Equal(list.Good, []string{"4.4.4.4:27017"}) {
+		t.Fatalf("unexpected stored list %+v", list)
+	}
+}
+
+func TestSteamDirectoryOffline(t *testing.T) {
+
+	store := &memoryDirectoryStore{list: &CMList{
+		Servers: []string{"1.1.1.1:27017"},
+		Time:    time.Now().Add(-time.Hour),
+	}}
+	h, _ := newTestHandler(t, &Config{DirectoryStore: store})
+
+	h.refreshSteamDirectory()
+	status := h.GetDirectoryStatus()
+	if !status.Cached || status.Servers != 1 || status.Err == "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if cm := h.cms.Select("region"); cm != "1.1.1.1:27017" {
+		t.Fatalf("cached CM not used, got %s", cm)
+	}
+}
+
+func TestFileDirectoryStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "cms.json")
+	fetched := &CMList{Servers: []string{"1.1.1.1:27017"}, WebSockets: []string{"ws.steam:443"}, Time: time.Now()}
+
+	h, _ := newTestHandler(t, &Config{
+		DirectoryStore: &FileDirectoryStore{Path: path},
+		FetchDirectory: func() (*CMList, error) { return fetched, nil },
+	})
+	h.cms.Success("region", "1.1.1.1:27017", time.Millisecond)
+	h.refreshSteamDirectory()
+
+	list, err := (&FileDirectoryStore{Path: path}).GetCMList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list == nil || !slices.Equal(list.Servers, fetched.Servers) || !slices.Equal(list.WebSockets, fetched.WebSockets) || !slices.Equal(list.Good, []string{"1.1.1.1:27017"}) {
+		t.Fatalf("unexpected stored list %+v", list)
+	}
+
+	// WebSockets start from the cache as well
+	h, _ = newTestHandler(t, &Config{DirectoryStore: &FileDirectoryStore{Path: path}, Transport: WebSocket})
+	if cm := h.cms.Select("region"); cm != "ws.steam:443" {
+		t.Fatalf("expected cached WebSocket CM, got %s", cm)
+	}
+}
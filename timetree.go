@@ -23,6 +23,12 @@ type Task struct {
 	Time  int64
 }
 
+// TaskHandle cancels a scheduled task
+type TaskHandle interface {
+	// Cancel removes the task if it didn't run yet, false if it already ran or was cancelled
+	Cancel() bool
+}
+
 type TimeTree struct {
 	tree  *rbt.Tree
 	timer *time.Timer
@@ -55,13 +61,15 @@ func (t *TimeTree) Run(f func(*Task)) {
 					break
 				}
 
+				// Remove first, so it can't be cancelled anymore once it runs
+				task := node.Value.(*Task)
+				t.tree.Remove(nsec)
+
 				// We need to unlock here to prevent a deadlock in case the task issues a new task
 				// Rare case where you unlock and then lock as opposed to locking and unlocking
 				t.mutex.Unlock()
-				task := node.Value.(*Task)
 				f(task)
 				t.mutex.Lock()
-				t.tree.Remove(nsec)
 			}
 			t.mutex.Unlock()
 		case <-t.c:
@@ -74,7 +82,7 @@ func (t *TimeTree) Stop() {
 	t.c <- struct{}{}
 }
 
-func (t *TimeTree) AddTask(task *Task) {
+func (t *TimeTree) AddTask(task *Task) TaskHandle {
 	t.mutex.Lock()
 
 	// Check rare case where a task is scheduled at the exact same nanosecond
@@ -85,6 +93,8 @@ func (t *TimeTree) AddTask(task *Task) {
 	t.tree.Put(task.Time, task)
 	t.resetTimer()
 	t.mutex.Unlock()
+
+	return &treeHandle{tree: t, task: task, time: task.Time}
 }
 
 func (t *TimeTree) RemoveTask(n int64) {
@@ -102,3 +112,23 @@ func (t *TimeTree) resetTimer() {
 
 	t.timer.Reset(time.Until(time.Unix(0, node.Key.(int64))))
 }
+
+// treeHandle remembers the key of the task, the same task might be added again with a different Time
+type treeHandle struct {
+	tree *TimeTree
+	task *Task
+	time int64
+}
+
+func (h *treeHandle) Cancel() bool {
+	t := h.tree
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if v, ok := t.tree.Get(h.time); !ok || v.(*Task) != h.task {
+		return false
+	}
+	t.tree.Remove(h.time)
+	t.resetTimer()
+	return true
+}
@@ -0,0 +1,358 @@
+package inspect
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	wheelLevels   = 4
+	wheelBits     = 8
+	wheelSlots    = 1 << wheelBits
+	wheelMask     = wheelSlots - 1
+	wheelBitmaps  = wheelSlots / 64
+	wheelTickBase = time.Millisecond
+)
+
+// Scheduler runs tasks at their Time, TimeTree and TimingWheel implement it
+type Scheduler interface {
+	Run(f func(*Task))
+	Stop()
+	// AddTask schedules the task, its Time is bumped until it is unique
+	AddTask(task *Task) TaskHandle
+	// RemoveTask removes the task scheduled at exactly n, prefer the TaskHandle
+	RemoveTask(n int64)
+}
+
+// TimingWheel is a hierarchical timing wheel, a Scheduler with O(1) AddTask and RemoveTask.
+// Tasks are put into slots of one tick, level 0 covers 256 ticks, each further level 256 times more.
+// Slots of higher levels are cascaded down whenever the lower level wraps around.
+// Tasks run with a precision of one tick, never early.
+type TimingWheel struct {
+	tick    int64 // Nanoseconds
+	current int64 // Last processed tick
+
+	levels   [wheelLevels][wheelSlots]wheelEntry // Sentinels of the slot lists
+	occupied [wheelLevels][wheelBitmaps]uint64
+	overflow wheelEntry // Beyond the last level
+	due      wheelEntry // Already expired, run on the next advance
+
+	tasks  map[int64]*wheelEntry // Map Time to Entry for RemoveTask
+	wakeAt int64                 // Tick Run sleeps until
+	mutex  sync.Mutex
+
+	wake chan struct{}
+	c    chan struct{}
+}
+
+// NewTimingWheel creates a TimingWheel with the given tick, 1ms if tick is 0
+func NewTimingWheel(tick time.Duration) *TimingWheel {
+
+	if tick <= 0 {
+		tick = wheelTickBase
+	}
+
+	t := &TimingWheel{
+		tick:  int64(tick),
+		tasks: make(map[int64]*wheelEntry),
+		wake:  make(chan struct{}, 1),
+		c:     make(chan struct{}),
+	}
+	t.current = time.Now().UnixNano() / t.tick
+	t.wakeAt = math.MaxInt64
+
+	for l := range t.levels {
+		for s := range t.levels[l] {
+			t.levels[l][s].init()
+		}
+	}
+	t.overflow.init()
+	t.due.init()
+
+	return t
+}
+
+func (t *TimingWheel) Run(f func(*Task)) {
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	var run []*Task
+	for {
+		t.mutex.Lock()
+		delay, ok := t.nextDelay(time.Now().UnixNano())
+		t.mutex.Unlock()
+
+		if ok {
+			timer.Reset(delay)
+		}
+
+		select {
+		case <-timer.C:
+		case <-t.wake:
+			timer.Stop()
+		case <-t.c:
+			timer.Stop()
+			return
+		}
+
+		run = t.advance(time.Now().UnixNano(), run[:0])
+
+		// Run without holding the lock, the task might issue new tasks
+		for i, task := range run {
+			f(task)
+			run[i] = nil
+		}
+	}
+}
+
+func (t *TimingWheel) Stop() {
+	t.c <- struct{}{}
+}
+
+func (t *TimingWheel) AddTask(task *Task) TaskHandle {
+
+	t.mutex.Lock()
+
+	// Same as the TimeTree, the Time identifies the task
+	for _, ok := t.tasks[task.Time]; ok; _, ok = t.tasks[task.Time] {
+		task.Time++
+	}
+
+	e := &wheelEntry{
+		wheel: t,
+		task:  task,
+		time:  task.Time,
+		tick:  (task.Time + t.tick - 1) / t.tick, // Round up, never run early
+	}
+	t.tasks[task.Time] = e
+
+	// Wake Run if it sleeps past the new slot
+	event := t.insert(e)
+	wake := event < t.wakeAt
+	if wake {
+		t.wakeAt = event
+	}
+	t.mutex.Unlock()
+
+	if wake {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return e
+}
+
+func (t *TimingWheel) RemoveTask(n int64) {
+	t.mutex.Lock()
+	if e := t.tasks[n]; e != nil {
+		delete(t.tasks, n)
+		t.unlink(e)
+	}
+	t.mutex.Unlock()
+}
+
+// wheelEntry is the TaskHandle of the TimingWheel
+type wheelEntry struct {
+	wheel      *TimingWheel
+	task       *Task
+	time       int64 // Key in tasks, the task might be added again with a different Time
+	tick       int64
+	prev, next *wheelEntry // nil once it ran or got cancelled
+	level      int         // -1 if not in a wheel slot
+	slot       int
+}
+
+func (e *wheelEntry) Cancel() bool {
+	t := e.wheel
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if e.prev == nil {
+		return false
+	}
+	delete(t.tasks, e.time)
+	t.unlink(e)
+	return true
+}
+
+// insert puts the entry into the lowest level which still has to pass its tick,
+// it returns the tick its slot gets processed
+func (t *TimingWheel) insert(e *wheelEntry) int64 {
+
+	if e.tick <= t.current {
+		e.level = -1
+		t.due.push(e)
+		return t.current
+	}
+
+	for l := range wheelLevels {
+		shift := uint(wheelBits * (l + 1))
+		if e.tick>>shift != t.current>>shift {
+			continue
+		}
+
+		s := int(e.tick>>(wheelBits*l)) & wheelMask
+		e.level, e.slot = l, s
+		t.levels[l][s].push(e)
+		t.occupied[l][s/64] |= 1 << (s % 64)
+		return e.tick >> (wheelBits * l) << (wheelBits * l)
+	}
+
+	e.level = -1
+	t.overflow.push(e)
+
+	const shift = wheelBits * wheelLevels
+	return (t.current>>shift + 1) << shift
+}
+
+func (t *TimingWheel) unlink(e *wheelEntry) {
+	e.remove()
+	if e.level >= 0 && t.levels[e.level][e.slot].empty() {
+		t.occupied[e.level][e.slot/64] &^= 1 << (e.slot % 64)
+	}
+}
+
+// cascade moves all entries of the slot down to the levels below
+func (t *TimingWheel) cascade(l, s int) {
+	head := &t.levels[l][s]
+	for e := head.next; e != head; e = head.next {
+		e.remove()
+		t.insert(e)
+	}
+	t.occupied[l][s/64] &^= 1 << (s % 64)
+}
+
+// cascadeOverflow moves entries of the overflow into the wheel, the ones still too far ahead stay
+func (t *TimingWheel) cascadeOverflow() {
+
+	var list wheelEntry
+	list.init()
+	for e := t.overflow.next; e != &t.overflow; e = t.overflow.next {
+		e.remove()
+		list.push(e)
+	}
+
+	for e := list.next; e != &list; e = list.next {
+		e.remove()
+		t.insert(e)
+	}
+}
+
+// advance processes all ticks up to now and appends the expired tasks to run
+func (t *TimingWheel) advance(now int64, run []*Task) []*Task {
+
+	target := now / t.tick
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	run = t.drain(&t.due, run)
+
+	for t.current < target {
+		// Skip ticks without anything to do
+		t.current = min(t.nextEvent(), target)
+
+		// Cascade from the top, so entries end up in the right slot of the first level
+		if t.current&wheelMask == 0 {
+			var l int
+			for l = 1; l < wheelLevels && (t.current>>(wheelBits*l))&wheelMask == 0; l++ {
+			}
+			if l == wheelLevels {
+				t.cascadeOverflow()
+				l--
+			}
+			for ; l >= 1; l-- {
+				t.cascade(l, int(t.current>>(wheelBits*l))&wheelMask)
+			}
+		}
+
+		s := int(t.current & wheelMask)
+		run = t.drain(&t.levels[0][s], run)
+		t.occupied[0][s/64] &^= 1 << (s % 64)
+		run = t.drain(&t.due, run)
+	}
+
+	return run
+}
+
+func (t *TimingWheel) drain(head *wheelEntry, run []*Task) []*Task {
+	for e := head.next; e != head; e = head.next {
+		e.remove()
+		delete(t.tasks, e.time)
+		run = append(run, e.task)
+	}
+	return run
+}
+
+// nextDelay returns how long Run can sleep, false if there is nothing scheduled
+func (t *TimingWheel) nextDelay(now int64) (time.Duration, bool) {
+
+	if !t.due.empty() {
+		t.wakeAt = t.current
+		return 0, true
+	}
+
+	t.wakeAt = t.nextEvent()
+	if t.wakeAt > math.MaxInt64/t.tick {
+		return 0, false
+	}
+	return time.Duration(max(t.wakeAt*t.tick-now, 0)), true
+}
+
+// nextEvent returns the next tick with a slot to run or cascade
+func (t *TimingWheel) nextEvent() int64 {
+
+	next := int64(math.MaxInt64)
+	for l := range wheelLevels {
+		shift := uint(wheelBits * l)
+		from := int(t.current>>shift)&wheelMask + 1
+		if s := nextOccupied(&t.occupied[l], from); s >= 0 {
+			epoch := t.current >> (shift + wheelBits) << (shift + wheelBits)
+			next = min(next, epoch|int64(s)<<shift)
+		}
+	}
+
+	if !t.overflow.empty() {
+		const shift = wheelBits * wheelLevels
+		next = min(next, (t.current>>shift+1)<<shift)
+	}
+
+	return next
+}
+
+// nextOccupied returns the first occupied slot starting at from, -1 if there is none
+func nextOccupied(bitmap *[wheelBitmaps]uint64, from int) int {
+	for i := from / 64; i < wheelBitmaps && from < wheelSlots; i++ {
+		if word := bitmap[i] >> (from % 64); word != 0 {
+			return from + bits.TrailingZeros64(word)
+		}
+		from = (i + 1) * 64
+	}
+	return -1
+}
+
+func (e *wheelEntry) init() {
+	e.prev, e.next = e, e
+}
+
+func (e *wheelEntry) empty() bool {
+	return e.next == e
+}
+
+// push appends the entry to the list of the sentinel e
+func (e *wheelEntry) push(entry *wheelEntry) {
+	entry.prev, entry.next = e.prev, e
+	e.prev.next = entry
+	e.prev = entry
+}
+
+func (e *wheelEntry) remove() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
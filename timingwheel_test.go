@@ -0,0 +1,193 @@
+package inspect
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/0xAozora/cs2-inspect/internal/protoconflict"
+)
+
+func TestTimingWheelAdvance(t *testing.T) {
+
+	// One tick per nanosecond, so all levels and the overflow get used
+	w := NewTimingWheel(1)
+	w.current = 0
+
+	rng := rand.New(rand.NewSource(1))
+
+	pending := make(map[*Task]bool)
+	for range 20000 {
+		var n int64
+		switch rng.Intn(4) {
+		case 0:
+			n = rng.Int63n(1 << 8)
+		case 1:
+			n = rng.Int63n(1 << 20)
+		case 2:
+			n = rng.Int63n(1 << 30)
+		default:
+			n = rng.Int63n(1 << 36)
+		}
+		task := &Task{Time: n}
+		w.AddTask(task)
+		pending[task] = true
+	}
+
+	// Remove some again
+	var removed int
+	for task := range pending {
+		if removed == 1000 {
+			break
+		}
+		w.RemoveTask(task.Time)
+		delete(pending, task)
+		removed++
+	}
+
+	var now int64
+	for len(pending) != 0 {
+		now += rng.Int63n(1 << 28)
+
+		for _, task := range w.advance(now, nil) {
+			if task.Time > now {
+				t.Fatalf("task at %d ran early at %d", task.Time, now)
+			}
+			if !pending[task] {
+				t.Fatalf("task at %d ran twice or after removal", task.Time)
+			}
+			delete(pending, task)
+		}
+
+		for task := range pending {
+			if task.Time <= now {
+				t.Fatalf("task at %d missed at %d", task.Time, now)
+			}
+		}
+	}
+
+	if len(w.tasks) != 0 {
+		t.Fatalf("%d tasks left", len(w.tasks))
+	}
+}
+
+func TestTimingWheelRun(t *testing.T) {
+
+	w := NewTimingWheel(time.Millisecond)
+
+	done := make(chan *Task, 3)
+	go w.Run(func(task *Task) {
+		done <- task
+	})
+	defer w.Stop()
+
+	now := time.Now()
+	removed := &Task{Time: now.Add(20 * time.Millisecond).UnixNano()}
+	w.AddTask(&Task{Time: now.Add(300 * time.Millisecond).UnixNano()}) // Second level
+	w.AddTask(removed)
+	w.AddTask(&Task{Time: now.Add(10 * time.Millisecond).UnixNano()})
+	w.AddTask(&Task{Time: now.Add(-time.Second).UnixNano()}) // Already expired
+	w.RemoveTask(removed.Time)
+
+	var last int64
+	for range 3 {
+		select {
+		case task := <-done:
+			if time.Now().UnixNano() < task.Time {
+				t.Fatal("task ran early")
+			}
+			if task.Time < last {
+				t.Fatal("tasks out of order")
+			}
+			last = task.Time
+		case <-time.After(2 * time.Second):
+			t.Fatal("task did not run")
+		}
+	}
+
+	select {
+	case <-done:
+		t.Fatal("removed task ran")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTaskHandle(t *testing.T) {
+	for name, s := range map[string]Scheduler{
+		"timetree": NewTimeTree(),
+		"wheel":    NewTimingWheel(time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			done := make(chan *Task, 2)
+			go s.Run(func(task *Task) {
+				done <- task
+			})
+			defer s.Stop()
+
+			cancelled := s.AddTask(&Task{Time: time.Now().Add(10 * time.Millisecond).UnixNano()})
+			if !cancelled.Cancel() || cancelled.Cancel() {
+				t.Fatal("task not cancelled exactly once")
+			}
+
+			task := &Task{Time: time.Now().Add(10 * time.Millisecond).UnixNano()}
+			handle := s.AddTask(task)
+			if <-done != task {
+				t.Fatal("unexpected task")
+			}
+			if handle.Cancel() {
+				t.Fatal("cancelled task which already ran")
+			}
+
+			// Adding the same task again must not be cancelled by the previous handle
+			task.Time = time.Now().Add(10 * time.Millisecond).UnixNano()
+			s.AddTask(task)
+			if handle.Cancel() {
+				t.Fatal("previous handle cancelled the task")
+			}
+
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("task did not run")
+			}
+		})
+	}
+}
+
+// BenchmarkScheduler adds inspect timeouts and cancels the oldest ones again,
+// keeping the given amount of tasks scheduled
+func BenchmarkScheduler(b *testing.B) {
+	for _, size := range []int{1000, 50000} {
+		b.Run(fmt.Sprintf("tasks=%d/timetree", size), func(b *testing.B) {
+			benchmarkScheduler(b, NewTimeTree(), size)
+		})
+		b.Run(fmt.Sprintf("tasks=%d/wheel", size), func(b *testing.B) {
+			benchmarkScheduler(b, NewTimingWheel(0), size)
+		})
+	}
+}
+
+func benchmarkScheduler(b *testing.B, s Scheduler, size int) {
+
+	now := time.Now().Add(time.Hour).UnixNano() // Never due
+	var next atomic.Int64
+
+	b.RunParallel(func(pb *testing.PB) {
+		ring := make([]TaskHandle, size/4+1)
+		var i int
+		for pb.Next() {
+			if handle := ring[i]; handle != nil {
+				handle.Cancel()
+			}
+
+			ring[i] = s.AddTask(&Task{
+				T:    InspectTimeout,
+				Time: now + next.Add(1)*int64(time.Microsecond),
+			})
+			i = (i + 1) % len(ring)
+		}
+	})
+}
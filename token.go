@@ -0,0 +1,175 @@
+package inspect
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultTokenRenewBefore = 30 * 24 * time.Hour
+	tokenRenewRetry         = 24 * time.Hour // Steam only renews tokens it deems close to expiry
+)
+
+// tokenExpiry returns the exp claim of a refresh token, which is a JWT
+func tokenExpiry(token string) (time.Time, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, errors.New("token has no expiry")
+	}
+
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// trackToken records the expiry of the token of the bot, it returns false if the token already expired
+func (h *Handler) trackToken(bot *Bot, token string) bool {
+
+	expiry, err := tokenExpiry(token)
+	if err != nil {
+		// Let Steam judge the token
+		h.log.Warn().
+			Err(err).
+			Str("bot", bot.Name).
+			Msg("Unknown refresh token expiry")
+		bot.tokenExpiry.Store(0)
+		return true
+	}
+	bot.tokenExpiry.Store(expiry.Unix())
+
+	return time.Now().Before(expiry)
+}
+
+// scheduleTokenRenewal renews the refresh token once it is about to expire
+func (h *Handler) scheduleTokenRenewal(bot *Bot, delay time.Duration) {
+
+	if delay == 0 {
+		expiry := bot.tokenExpiry.Load()
+		if expiry == 0 {
+			return
+		}
+		delay = max(time.Until(time.Unix(expiry, 0).Add(-h.tokenRenewBefore)), 0)
+	}
+
+	task := &Task{
+		T: Function,
+		Value: func() {
+			// The next login schedules it again
+			if bot.status == DISCONNECTED || bot.status == CONNECTED || bot.removed.Load() {
+				return
+			}
+			if err := h.renewToken(bot); err != nil {
+				h.log.Err(err).
+					Str("bot", bot.Name).
+					Msg("Error renewing refresh token")
+
+				h.scheduleTokenRenewal(bot, tokenRenewRetry)
+			}
+		},
+		Time: time.Now().Add(delay).UnixNano(),
+	}
+
+	bot.gcMutex.Lock()
+	if bot.renewal != nil {
+		bot.renewal.Cancel()
+	}
+	bot.renewal = h.scheduler.AddTask(task)
+	bot.gcMutex.Unlock()
+}
+
+// renewToken asks Steam for a new refresh token, it only issues one if the current one is close to expiry
+func (h *Handler) renewToken(bot *Bot) error {
+
+	token, err := h.tokenDB.GetToken(bot.Name)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.New("no refresh token")
+	}
+
+	h.log.Info().
+		Str("bot", bot.Name).
+		Msg("Renewing refresh token")
+
+	msg := protocol.NewClientMsgProtobuf(steamlang.EMsg_ServiceMethodCallFromClient, &protobuf.CAuthentication_AccessToken_GenerateForApp_Request{
+		RefreshToken: proto.String(token),
+		Steamid:      proto.Uint64(uint64(bot.client.SteamId())),
+		RenewalType:  protobuf.ETokenRenewalType_k_ETokenRenewalType_Allow.Enum(),
+	})
+	jobname := "Authentication.GenerateAccessTokenForApp#1"
+	msg.Header.Proto.TargetJobName = &jobname
+	jobID := bot.client.GetNextJobId()
+	msg.SetSourceJobId(jobID)
+
+	bot.client.JobMutex.Lock()
+	bot.client.JobHandlers[uint64(jobID)] = func(packet *protocol.Packet) error {
+		h.handleTokenRenewal(bot, packet)
+		return nil
+	}
+	bot.client.JobMutex.Unlock()
+
+	return bot.client.Write(msg)
+}
+
+func (h *Handler) handleTokenRenewal(bot *Bot, packet *protocol.Packet) {
+
+	body := new(protobuf.CAuthentication_AccessToken_GenerateForApp_Response)
+	msg := packet.ReadProtoMsg(body)
+
+	if eresult := steamlang.EResult(msg.Header.Proto.GetEresult()); eresult != steamlang.EResult_OK {
+		h.log.Warn().
+			Str("bot", bot.Name).
+			Str("result", steamlang.EResult_name[eresult]).
+			Msg("Refresh token renewal failed")
+
+		h.scheduleTokenRenewal(bot, tokenRenewRetry)
+		return
+	}
+
+	token := body.GetRefreshToken()
+	if token == "" {
+		h.log.Debug().
+			Str("bot", bot.Name).
+			Msg("Refresh token not renewed yet")
+
+		h.scheduleTokenRenewal(bot, tokenRenewRetry)
+		return
+	}
+
+	if err := h.tokenDB.SetToken(bot.Name, token); err != nil {
+		h.log.Err(err).
+			Str("bot", bot.Name).
+			Msg("Error saving renewed refresh token")
+	}
+	h.trackToken(bot, token)
+
+	h.log.Info().
+		Str("bot", bot.Name).
+		Time("expiry", time.Unix(bot.tokenExpiry.Load(), 0)).
+		Msg("Renewed refresh token")
+
+	h.scheduleTokenRenewal(bot, 0)
+}
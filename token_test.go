@@ -0,0 +1,190 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+	"google.golang.org/protobuf/proto"
+)
+
+// memoryDB is a TokenDB in memory
+type memoryDB map[string]string
+
+func (db memoryDB) GetToken(name string) (string, error) { return db[name], nil }
+func (db memoryDB) SetToken(name, token string) error {
+	db[name] = token
+	return nil
+}
+
+// failingDB is a TokenDB which fails every call
+type failingDB struct{}
+
+func (failingDB) GetToken(string) (string, error) { return "", errors.New("unavailable") }
+func (failingDB) SetToken(string, string) error   { return errors.New("unavailable") }
+
+// leasedDB is a TokenDB whose accounts another instance holds
+type leasedDB struct{}
+
+func (leasedDB) GetToken(string) (string, error) { return "", ErrNotLeased }
+func (leasedDB) SetToken(string, string) error   { return ErrNotLeased }
+
+// newResponse is a service method response with the result in its header
+func newResponse(t *testing.T, eresult steamlang.EResult, body proto.Message) *protocol.Packet {
+	t.Helper()
+	msg := protocol.NewClientMsgProtobuf(steamlang.EMsg_ServiceMethodResponse, body)
+	msg.Header.Proto.Eresult = proto.Int32(int32(eresult))
+
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.NewPacket(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func newJWT(exp time.Time) string {
+	payload := fmt.Sprintf(`{"iss":"steam","sub":"76561198000000000","exp":%d}`, exp.Unix())
+	return "eyJhbGciOiJFZERTQSJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2ln"
+}
+
+func TestTokenExpiry(t *testing.T) {
+
+	exp := time.Unix(1893456000, 0)
+	got, err := tokenExpiry(newJWT(exp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(exp) {
+		t.Fatalf("expected %s, got %s", exp, got)
+	}
+
+	for _, token := range []string{"", "token", "a.!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".c"} {
+		if _, err := tokenExpiry(token); err == nil {
+			t.Fatalf("expected error for %q", token)
+		}
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+
+	h, _ := newTestHandler(t, &Config{})
+	db := memoryDB{"bot": newJWT(time.Now().Add(-time.Hour))}
+	h.tokenDB = db
+	bot, _ := newHeartbeatBot(h, "bot")
+
+	// Logs in with the credentials instead
+	if h.trackToken(bot, db["bot"]) {
+		t.Fatal("expired token accepted")
+	}
+	if bot.tokenExpiry.Load() == 0 {
+		t.Fatal("expiry not tracked")
+	}
+}
+
+func TestLoginTokenDBError(t *testing.T) {
+
+	for _, c := range []struct {
+		name     string
+		db       TokenDB
+		disabled bool
+	}{{"leased", leasedDB{}, true}, {"unavailable", failingDB{}, false}} {
+
+		h, s := newTestHandler(t, &Config{})
+		h.tokenDB = c.db
+		bot, conn := newHeartbeatBot(h, "bot")
+		bot.status = DISCONNECTED // Nothing to disconnect
+
+		// No login with the credentials, which would kick the session of the other instance
+		h.loginBot(bot)
+		expectNoWrite(t, conn)
+
+		if bot.disabled.Load() != c.disabled {
+			t.Fatalf("%s: expected disabled %t", c.name, c.disabled)
+		}
+		if reconnects := len(s.tasks); c.disabled && reconnects != 0 || !c.disabled && reconnects != 1 {
+			t.Fatalf("%s: unexpected %d reconnects", c.name, reconnects)
+		}
+	}
+}
+
+func TestTokenRenewal(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	h.tokenRenewBefore = 30 * 24 * time.Hour
+	db := memoryDB{"bot": newJWT(time.Now().Add(10 * 24 * time.Hour))}
+	h.tokenDB = db
+	bot, conn := newHeartbeatBot(h, "bot")
+
+	// Within the renewal window, it renews right away
+	h.trackToken(bot, db["bot"])
+	h.scheduleTokenRenewal(bot, 0)
+	if len(s.tasks) != 1 || time.Until(time.Unix(0, s.tasks[0].task.Time)) > time.Second {
+		t.Fatal("renewal not scheduled right away")
+	}
+	task := s.take(s.tasks[0].task)
+	task.Value.(func())()
+	expectWrite(t, conn, steamlang.EMsg_ServiceMethodCallFromClient)
+
+	// Steam didn't renew it yet
+	h.handleTokenRenewal(bot, newResponse(t, steamlang.EResult_OK,
+		&protobuf.CAuthentication_AccessToken_GenerateForApp_Response{}))
+	if len(s.tasks) != 1 || time.Until(time.Unix(0, s.tasks[0].task.Time)) < tokenRenewRetry-time.Minute {
+		t.Fatal("renewal not retried later")
+	}
+
+	renewed := newJWT(time.Now().Add(200 * 24 * time.Hour))
+	h.handleTokenRenewal(bot, newResponse(t, steamlang.EResult_OK,
+		&protobuf.CAuthentication_AccessToken_GenerateForApp_Response{RefreshToken: proto.String(renewed)}))
+
+	if db["bot"] != renewed {
+		t.Fatal("renewed token not saved")
+	}
+	info := h.GetBotInfos()[0]
+	if time.Until(info.TokenExpiry) < 199*24*time.Hour {
+		t.Fatalf("expiry not updated, got %s", info.TokenExpiry)
+	}
+
+	// The next renewal is due 30 days before the new expiry
+	if len(s.tasks) != 1 || time.Until(time.Unix(0, s.tasks[0].task.Time)) < 169*24*time.Hour {
+		t.Fatal("next renewal not scheduled")
+	}
+}
+
+func TestTokenRenewalFailure(t *testing.T) {
+
+	h, s := newTestHandler(t, &Config{})
+	db := memoryDB{"bot": newJWT(time.Now().Add(10 * 24 * time.Hour))}
+	h.tokenDB = db
+	bot, _ := newHeartbeatBot(h, "bot")
+	h.trackToken(bot, db["bot"])
+
+	// A failed result doesn't touch the body, even if it carries a token
+	h.handleTokenRenewal(bot, newResponse(t, steamlang.EResult_AccessDenied,
+		&protobuf.CAuthentication_AccessToken_GenerateForApp_Response{RefreshToken: proto.String("bogus")}))
+	if db["bot"] == "bogus" {
+		t.Fatal("token of a failed renewal saved")
+	}
+	if len(s.tasks) != 1 || time.Until(time.Unix(0, s.tasks[0].task.Time)) < tokenRenewRetry-time.Minute {
+		t.Fatal("failed renewal not retried later")
+	}
+
+	// An unreachable TokenDB is retried later too
+	h.tokenDB = failingDB{}
+	bot.status = LOGGED_IN
+	h.scheduleTokenRenewal(bot, time.Millisecond)
+	task := s.take(s.tasks[len(s.tasks)-1].task)
+	task.Value.(func())()
+	if len(s.tasks) == 0 || time.Until(time.Unix(0, s.tasks[len(s.tasks)-1].task.Time)) < tokenRenewRetry-time.Minute {
+		t.Fatal("renewal not retried after a TokenDB error")
+	}
+}
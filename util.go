@@ -1,18 +1,78 @@
 package inspect
 
 import (
+	"errors"
+	"fmt"
 	"net"
-	"unsafe"
+	"syscall"
+	"time"
 
-	"github.com/0xAozora/go-steam"
+	"golang.org/x/net/proxy"
 )
 
-func getTCPConn(client *steam.Client) *net.TCPConn {
+// ErrNotPollable is returned when the connection of a bot does not expose a file descriptor
+var ErrNotPollable = errors.New("connection is not pollable")
 
-	ptr := unsafe.Add(unsafe.Pointer(&client.Conn), uintptr(8)) // Skip Type Info to get pointer of the underlying structure
-	ptr = *(*unsafe.Pointer)(ptr)                               // Dereference to get the pointer to net.Conn
-	ptr = unsafe.Add(ptr, uintptr(8))                           // Get actual pointer to the TCPConn (Skipping Type Info)
-	conn := *(**net.TCPConn)(ptr)
+// hookDialer wraps the dialer of a bot and keeps the connection it dialed.
+// This is the raw connection to the CM or the proxy we register in the poller,
+// so we don't need to dig it out of the steam.Client.
+type hookDialer struct {
+	dialer proxy.Dialer // nil to dial directly
+	conn   net.Conn
+}
+
+func (d *hookDialer) Dial(network, address string) (net.Conn, error) {
+
+	var conn net.Conn
+	var err error
+	if d.dialer != nil {
+		conn, err = d.dialer.Dial(network, address)
+	} else {
+		conn, err = net.DialTimeout(network, address, 10*time.Second)
+	}
+
+	d.conn = conn
+	return conn, err
+}
+
+// pollFD returns the file descriptor of the connection
+func pollFD(conn net.Conn) (uint64, error) {
+
+	raw, err := syscallConn(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	var fd uint64
+	if err = raw.Control(func(f uintptr) {
+		fd = uint64(f)
+	}); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrNotPollable, err)
+	}
+	return fd, nil
+}
+
+// syscallConn returns the syscall.RawConn of the connection.
+// Wrapping connections like tls.Conn are unwrapped through their NetConn method.
+func syscallConn(conn net.Conn) (syscall.RawConn, error) {
+
+	for conn != nil {
+
+		switch c := conn.(type) {
+		case syscall.Conn:
+			raw, err := c.SyscallConn()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrNotPollable, err)
+			}
+			return raw, nil
+
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+
+		default:
+			return nil, fmt.Errorf("%w: %T", ErrNotPollable, conn)
+		}
+	}
 
-	return conn
+	return nil, ErrNotPollable
 }
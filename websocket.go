@@ -0,0 +1,315 @@
+package inspect
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"golang.org/x/net/proxy"
+)
+
+// Transport is the protocol bots use to connect to CMs
+type Transport uint8
+
+const (
+	TCP       Transport = iota // Raw TCP on the CM ports (27017 etc.)
+	WebSocket                  // Secure WebSockets on port 443, passes through restrictive egress and HTTP proxies
+)
+
+const (
+	wsPath             = "/cmsocket/"
+	wsGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsHandshakeTimeout = 10 * time.Second
+	wsMaxPayload       = 64 << 20
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+var errWSClosed = errors.New("websocket closed by CM")
+
+// wsConnection implements the connection of a steam.Client over WebSockets.
+// Steam sends one packet per binary message, encryption is done by TLS,
+// so there is no channel encryption handshake and the bot can log in right away.
+type wsConnection struct {
+	conn net.Conn // TLS, except in tests
+	r    *bufio.Reader
+
+	writeMutex sync.Mutex // Control frames are written from the read path
+	writeBuf   []byte
+}
+
+// dialWebSocket connects to a WebSocket CM given as host:port
+func dialWebSocket(dialer proxy.Dialer, address string) (*wsConnection, error) {
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = raw.SetDeadline(time.Now().Add(wsHandshakeTimeout))
+
+	conn := tls.Client(raw, &tls.Config{ServerName: host})
+	if err = conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	ws, err := newWSConnection(conn, host)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	_ = raw.SetDeadline(time.Time{})
+
+	return ws, nil
+}
+
+// newWSConnection upgrades the connection to a WebSocket
+func newWSConnection(conn net.Conn, host string) (*wsConnection, error) {
+
+	ws := &wsConnection{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+
+	if err := ws.handshake(host); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (c *wsConnection) handshake(host string) error {
+
+	var nonce [16]byte
+	_, _ = rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+wsPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err = req.Write(c.conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+
+	h := sha1.Sum([]byte(key + wsGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(h[:]) {
+		return errors.New("websocket handshake failed: invalid accept key")
+	}
+
+	return nil
+}
+
+// Read returns the next packet, answering control frames on the way
+func (c *wsConnection) Read() (*protocol.Packet, error) {
+
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err = c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return nil, errWSClosed
+		case wsOpText, wsOpBinary:
+			message = payload
+		case wsOpContinuation:
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("invalid websocket opcode %d", op)
+		}
+
+		if fin {
+			return protocol.NewPacket(message)
+		}
+	}
+}
+
+func (c *wsConnection) readFrame() (fin bool, op byte, payload []byte, err error) {
+
+	var header [8]byte
+	if _, err = io.ReadFull(c.r, header[:2]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(c.r, header[:2]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err = io.ReadFull(c.r, header[:8]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(header[:8])
+	}
+
+	if length > wsMaxPayload {
+		err = fmt.Errorf("websocket frame too large: %d", length)
+		return
+	}
+
+	// Servers must not mask, but it doesn't hurt to handle it
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i&3]
+		}
+	}
+
+	return
+}
+
+// Write sends the message as a single binary frame
+func (c *wsConnection) Write(message []byte) error {
+	return c.writeFrame(wsOpBinary, message)
+}
+
+func (c *wsConnection) writeFrame(op byte, payload []byte) error {
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	size := len(payload)
+
+	// Header, extended length and mask
+	buf := c.writeBuf[:0]
+	buf = append(buf, 0x80|op)
+	switch {
+	case size < 126:
+		buf = append(buf, 0x80|byte(size))
+	case size <= 0xFFFF:
+		buf = append(buf, 0x80|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(size))
+	default:
+		buf = append(buf, 0x80|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(size))
+	}
+
+	// Clients have to mask every frame
+	var mask [4]byte
+	_, _ = rand.Read(mask[:])
+	buf = append(buf, mask[:]...)
+
+	offset := len(buf)
+	buf = append(buf, payload...)
+	for i := range size {
+		buf[offset+i] ^= mask[i&3]
+	}
+	c.writeBuf = buf
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *wsConnection) Close() error {
+	return c.conn.Close()
+}
+
+// TLS takes care of encryption
+func (c *wsConnection) SetEncryptionKey([]byte) {}
+
+func (c *wsConnection) IsEncrypted() bool {
+	return true
+}
+
+// WaitReadable blocks until data is available, without consuming it.
+// It must not be called while the connection is being read.
+func (c *wsConnection) WaitReadable() error {
+	_, err := c.r.Peek(1)
+	return err
+}
+
+// Pending reports whether there is data buffered in TLS or the reader,
+// the poller won't report the connection as readable for it.
+// It must only be called from the reading goroutine.
+func (c *wsConnection) Pending() bool {
+
+	if c.r.Buffered() != 0 {
+		return true
+	}
+
+	// Non blocking peek, a timeout leaves the TLS state intact
+	_ = c.conn.SetReadDeadline(time.Now())
+	_, err := c.r.Peek(1)
+	_ = c.conn.SetReadDeadline(time.Time{})
+
+	// Let the reader run into any other error
+	var netErr net.Error
+	return err == nil || !errors.As(err, &netErr) || !netErr.Timeout()
+}
+
+// connDialer hands out an already established connection
+type connDialer struct {
+	conn net.Conn
+}
+
+func (d connDialer) Dial(network, address string) (net.Conn, error) {
+	return d.conn, nil
+}
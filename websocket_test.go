@@ -0,0 +1,247 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xAozora/go-steam/protocol"
+	"github.com/0xAozora/go-steam/protocol/protobuf"
+	"github.com/0xAozora/go-steam/protocol/steamlang"
+)
+
+// wsFrame encodes an unmasked frame like a server sends it
+func wsFrame(fin bool, op byte, payload []byte) []byte {
+
+	b := []byte{op}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch size := len(payload); {
+	case size < 126:
+		b = append(b, byte(size))
+	case size <= 0xFFFF:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(size))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(size))
+	}
+	return append(b, payload...)
+}
+
+func newWSPipe() (*wsConnection, net.Conn) {
+	client, server := net.Pipe()
+	return &wsConnection{conn: client, r: bufio.NewReader(client)}, server
+}
+
+func wsMessage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := protocol.NewClientMsgProtobuf(steamlang.EMsg_ClientHeartBeat, new(protobuf.CMsgClientHeartBeat)).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWSWriteFrame(t *testing.T) {
+
+	client, server := newWSPipe()
+	defer client.Close()
+
+	// The server side reads with the same frame decoder, which unmasks
+	peer := &wsConnection{conn: server, r: bufio.NewReader(server)}
+
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+
+		payload := bytes.Repeat([]byte{0xAB}, size)
+		go client.Write(payload)
+
+		header, err := peer.r.Peek(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header[1]&0x80 == 0 {
+			t.Fatalf("%d bytes: frame not masked", size)
+		}
+		if length := header[1] & 0x7F; size >= 126 && length != 126 && length != 127 {
+			t.Fatalf("%d bytes: no extended length, got %d", size, length)
+		}
+
+		fin, op, got, err := peer.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fin || op != wsOpBinary || !bytes.Equal(got, payload) {
+			t.Fatalf("%d bytes: unexpected frame fin %t op %d, %d bytes", size, fin, op, len(got))
+		}
+	}
+}
+
+func TestWSRead(t *testing.T) {
+
+	client, server := newWSPipe()
+	defer client.Close()
+
+	message := wsMessage(t)
+	large := append(bytes.Clone(message), make([]byte, 70000)...)
+
+	go func() {
+		// Fragmented with a ping in between, an extended length one, then two messages at once
+		server.Write(wsFrame(false, wsOpBinary, message[:3]))
+		server.Write(wsFrame(false, wsOpPing, []byte("ping")))
+		server.Write(wsFrame(true, wsOpContinuation, message[3:]))
+		server.Write(wsFrame(true, wsOpBinary, large))
+		server.Write(append(wsFrame(true, wsOpBinary, message), wsFrame(true, wsOpBinary, message)...))
+	}()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		peer := &wsConnection{conn: server, r: bufio.NewReader(server)}
+		_, op, payload, _ := peer.readFrame()
+		if op == wsOpPong {
+			pong <- payload
+		}
+		close(pong)
+	}()
+
+	packet, err := client.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.EMsg != steamlang.EMsg_ClientHeartBeat || !bytes.Equal(packet.Data, message) {
+		t.Fatalf("unexpected packet %s", packet.EMsg)
+	}
+	if p := <-pong; string(p) != "ping" {
+		t.Fatalf("ping not answered, got %q", p)
+	}
+
+	if packet, err = client.Read(); err != nil || len(packet.Data) != len(large) {
+		t.Fatalf("extended length frame not read, %v", err)
+	}
+
+	// The second message is buffered along with the first one
+	if _, err = client.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if !client.Pending() {
+		t.Fatal("buffered message not pending")
+	}
+	if _, err = client.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Pending() {
+		t.Fatal("pending without data")
+	}
+}
+
+func TestWSReadErrors(t *testing.T) {
+
+	for _, c := range []struct {
+		name  string
+		frame []byte
+		err   func(error) bool
+	}{
+		{"close", wsFrame(true, wsOpClose, nil), func(err error) bool { return errors.Is(err, errWSClosed) }},
+		{"opcode", wsFrame(true, 0x3, nil), func(err error) bool { return err != nil }},
+		{"too large", []byte{0x82, 127, 0, 0, 0, 0, 0xFF, 0, 0, 0}, func(err error) bool { return err != nil }},
+		{"truncated", wsFrame(true, wsOpBinary, make([]byte, 10))[:6], func(err error) bool { return errors.Is(err, io.EOF) }},
+	} {
+		client, server := newWSPipe()
+		go func() {
+			server.Write(c.frame)
+			server.Close()
+		}()
+		if _, err := client.Read(); !c.err(err) {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		client.Close()
+	}
+}
+
+// wsServer accepts the upgrade like a CM and sends a message, accept overrides the accept key
+func wsServer(t *testing.T, message []byte, accept string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != wsPath || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			http.Error(w, "not a websocket", http.StatusForbidden)
+			return
+		}
+
+		if accept == "" {
+			h := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+			accept = base64.StdEncoding.EncodeToString(h[:])
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+		rw.Write(wsFrame(true, wsOpBinary, message))
+		rw.Flush()
+	}))
+}
+
+func TestWSHandshake(t *testing.T) {
+
+	message := wsMessage(t)
+	server := wsServer(t, message, "")
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := newWSConnection(conn, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	packet, err := ws.Read()
+	if err != nil || !bytes.Equal(packet.Data, message) {
+		t.Fatalf("message not read after handshake, %v", err)
+	}
+}
+
+func TestWSBadHandshake(t *testing.T) {
+
+	// Invalid accept key
+	server := wsServer(t, nil, "invalid")
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newWSConnection(conn, "localhost"); err == nil {
+		t.Fatal("invalid accept key accepted")
+	}
+	conn.Close()
+
+	// No upgrade
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	conn, err = net.Dial("tcp", plain.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newWSConnection(conn, "localhost"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected failed handshake, got %v", err)
+	}
+	conn.Close()
+}